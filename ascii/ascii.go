@@ -0,0 +1,123 @@
+/*
+	Package ascii converts images and videos to ASCII art. It is the library behind the goskii command and never
+	touches the terminal: art is returned as text, or written to any io.Writer.
+
+		art, err := ascii.FromImage(img, ascii.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		art.WriteTo(os.Stdout)
+*/
+package ascii
+
+import (
+	"image"
+	"io"
+
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// Art is a converted image. Colored art contains ANSI escape sequences and every line ends with a reset.
+type Art struct {
+	Text   string
+	Width  int // Width in characters
+	Height int // Height in characters
+}
+
+func (a *Art) String() string {
+	return a.Text
+}
+
+// WriteTo writes the text of the art to w.
+func (a *Art) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, a.Text)
+	return int64(n), err
+}
+
+// FromImage converts an image to ASCII art.
+func FromImage(img image.Image, opts Options) (*Art, error) {
+	c, err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := GridSize(img.Bounds().Dx(), img.Bounds().Dy(), opts)
+	width, height := c.pixelSize(cols, rows)
+
+	return &Art{
+		Text:   render(img, width, height, c),
+		Width:  cols,
+		Height: rows,
+	}, nil
+}
+
+/*
+	Turns an image as Options.Rotate and Options.Flip say, converts it to grayscale, resizes it to width x height
+	pixels, and generates ASCII art.
+
+	Images whose color model has an alpha channel and that have transparent pixels are drawn as the alpha mode
+	says: composited over the background color, or with the cells that are transparent, or under the threshold,
+	left blank.
+*/
+func render(img image.Image, width, height int, c *config) string {
+	var imageGray *image.Gray
+	var alpha [][]uint8
+
+	img = utils.Orient(img, c.orientation)
+
+	hasAlpha := utils.HasAlpha(img)
+	if hasAlpha && c.alpha == generator.AlphaBackground {
+		img = utils.Composite(img, c.background)
+		hasAlpha = false
+	}
+
+	if hasAlpha {
+		imageGray, alpha = utils.GrayscaleAlpha(img)
+		alpha = utils.ResizeAlpha(alpha, img.Bounds().Dx(), img.Bounds().Dy(), width, height, c.filter)
+		if c.alpha == generator.AlphaThreshold {
+			utils.ThresholdAlpha(alpha, c.alphaThreshold)
+		}
+	} else {
+		imageGray = utils.Grayscale(img)
+	}
+
+	resizedImage := utils.ResizeGray(imageGray, width, height, c.filter)
+	switch c.mode {
+	case generator.ModeBraille:
+		resizedImage = generator.Dither(resizedImage, 2, c.dither)
+	case generator.ModeASCII, generator.ModeEdges:
+		resizedImage = generator.DitherCharset(resizedImage, c.charset, c.dither)
+	}
+
+	var colors *image.RGBA
+	if c.colorMode != generator.ColorNone {
+		colors = utils.ResizeRGBA(img, width, height, c.filter)
+	}
+
+	if c.mode == generator.ModeHalfBlock {
+		return generator.GenerateHalfBlock(colors, alpha, width, height, c.colorMode)
+	}
+
+	if c.mode == generator.ModeEdges {
+		edges := utils.ResizeEdges(utils.DetectEdges(imageGray, c.scharr), width, height)
+		return generator.GenerateEdges(resizedImage, edges, colors, alpha, width, height, c.charset, c.edgeThreshold, c.colorMode)
+	}
+
+	if c.mode == generator.ModeShape {
+		return generator.GenerateShapes(resizedImage, c.shapes, colors, alpha, width, height, c.colorMode)
+	}
+
+	if c.mode == generator.ModeBraille {
+		return generator.GenerateBraille(resizedImage, colors, width, height, c.threshold, c.colorMode)
+	}
+
+	if colors != nil {
+		return generator.GenerateASCIIColor(resizedImage, colors, alpha, width, height, c.charset, c.colorMode)
+	}
+
+	if alpha != nil {
+		return generator.GenerateASCIIAlpha(resizedImage, alpha, width, height, c.charset)
+	}
+	return generator.GenerateASCII(resizedImage, width, height, c.charset)
+}
@@ -0,0 +1,192 @@
+package ascii
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// DefaultWidth is the width in characters of art when Options.Width is 0.
+const DefaultWidth = 80
+
+// Font size in pixels the glyphs are rasterized at before being shrunk to the shape patch size.
+const shapeFontSize = 32
+
+// Options decide how images and video frames are turned into text. Start from DefaultOptions.
+type Options struct {
+	Width  int // Width of the art in characters, DefaultWidth if 0
+	Height int // Height of the art in characters. If 0 it keeps the aspect ratio of the source.
+
+	Mode    generator.RenderMode
+	Color   generator.ColorMode // Half blocks are always colored, with truecolor if this is ColorNone
+	Charset int                 // Number of the character set (1 - len(generator.GetCharsets())), 1 if 0
+	Chars   string              // Custom character ramp from the least to the most ink, overrides Charset
+	Dither  generator.DitherMode
+	Filter  utils.Filter // Resampling filter the source is resized with, box when shrinking if FilterAuto
+
+	Threshold     uint8  // Brightness at which a braille dot is raised
+	EdgeThreshold uint8  // Edge strength at which the edges mode draws a directional character
+	Scharr        bool   // Detect edges with the Scharr operator instead of Sobel
+	Font          string // TrueType/OpenType font the shape mode matches glyphs with, Go Mono if empty
+
+	Alpha          generator.AlphaMode // How transparent pixels are drawn, for sources with an alpha channel
+	AlphaThreshold uint8               // Opacity below which a cell is left blank with AlphaThreshold
+	Background     color.Color         // Color transparent pixels are composited over with AlphaBackground, black if nil
+
+	Rotate int        // Clockwise rotation in degrees, a multiple of 90, applied before Flip
+	Flip   utils.Flip // Mirroring applied after Rotate
+
+	FrameRate float64 // Frame rate videos are extracted at, their native rate if 0
+}
+
+// DefaultOptions returns the options the goskii command uses when no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		Charset:        1,
+		Threshold:      128,
+		EdgeThreshold:  64,
+		AlphaThreshold: 128,
+	}
+}
+
+// ColorMode returns the color mode the art is drawn with, which is truecolor for half blocks without a color mode.
+func (opts Options) ColorMode() generator.ColorMode {
+	// Half blocks are drawn entirely with colors, so they need a color mode to show anything.
+	if opts.Mode == generator.ModeHalfBlock && opts.Color == generator.ColorNone {
+		return generator.ColorTrue
+	}
+
+	return opts.Color
+}
+
+// config holds the resolved options shared by every frame.
+type config struct {
+	charset        *generator.Charset
+	colorMode      generator.ColorMode
+	mode           generator.RenderMode
+	threshold      uint8
+	dither         generator.DitherMode
+	filter         utils.Filter
+	edgeThreshold  float64
+	scharr         bool
+	shapes         *generator.ShapeMatcher
+	alpha          generator.AlphaMode
+	alphaThreshold uint8
+	background     color.Color
+	orientation    utils.Orientation // Rotate and Flip, applied to every image before it is converted
+}
+
+// charset returns the charset the options select. Options.Chars is made into a charset of its own, which is
+// never registered, so any number of ramps can be used side by side.
+func (opts Options) charset() (*generator.Charset, error) {
+	if opts.Chars != "" {
+		charset, err := generator.NewCharset(generator.SplitGlyphs(opts.Chars))
+		if err != nil {
+			return nil, fmt.Errorf("chars error: %v", err)
+		}
+		return charset, nil
+	}
+
+	number := opts.Charset
+	if number == 0 {
+		number = 1
+	}
+
+	charset, err := generator.GetCharset(number)
+	if err != nil {
+		return nil, fmt.Errorf("charset error: %v", err)
+	}
+
+	return charset, nil
+}
+
+// resolve validates the options and prepares what every frame needs.
+func (opts Options) resolve() (*config, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return nil, fmt.Errorf("size error: negative size %dx%d", opts.Width, opts.Height)
+	}
+
+	if opts.Rotate%90 != 0 {
+		return nil, fmt.Errorf("rotate error: %d is not a multiple of 90 degrees", opts.Rotate)
+	}
+
+	charset, err := opts.charset()
+	if err != nil {
+		return nil, err
+	}
+
+	colorMode := opts.ColorMode()
+
+	background := opts.Background
+	if background == nil {
+		background = color.Black
+	}
+
+	// Glyphs are rasterized once, the matcher is then shared by every frame
+	var shapes *generator.ShapeMatcher
+	if opts.Mode == generator.ModeShape {
+		face, err := generator.LoadFace(opts.Font, shapeFontSize)
+		if err != nil {
+			return nil, fmt.Errorf("font error: %v", err)
+		}
+		defer face.Close()
+
+		shapes, err = generator.NewShapeMatcher(face, charset)
+		if err != nil {
+			return nil, fmt.Errorf("shape error: %v", err)
+		}
+	}
+
+	return &config{
+		charset:        charset,
+		colorMode:      colorMode,
+		mode:           opts.Mode,
+		threshold:      opts.Threshold,
+		dither:         opts.Dither,
+		filter:         opts.Filter,
+		edgeThreshold:  float64(opts.EdgeThreshold),
+		scharr:         opts.Scharr,
+		shapes:         shapes,
+		alpha:          opts.Alpha,
+		alphaThreshold: opts.AlphaThreshold,
+		background:     background,
+		orientation:    opts.orientation(),
+	}, nil
+}
+
+/*
+	GridSize returns the size in characters of the art of a width x height pixel source. It is Options.Width by
+	Options.Height, with the default width and a height that keeps the aspect ratio of the source in place of
+	zeros. Characters are taken to be twice as tall as they are wide. The size is that of the source once it is
+	turned by Options.Rotate.
+*/
+func GridSize(width, height int, opts Options) (int, int) {
+	heightScale := 2.0 // default scale to compensate character height of the terminal
+
+	if opts.orientation().SwapsAxes() {
+		width, height = height, width
+	}
+
+	cols, rows := opts.Width, opts.Height
+	if cols == 0 {
+		cols = DefaultWidth
+	}
+	if rows == 0 {
+		rows = int(float64(height) * float64(cols) / (float64(width) * heightScale))
+	}
+
+	return max(cols, 1), max(rows, 1)
+}
+
+// orientation returns the orientation of Options.Rotate followed by Options.Flip.
+func (opts Options) orientation() utils.Orientation {
+	return utils.RotateFlip(opts.Rotate, opts.Flip)
+}
+
+// pixelSize returns the size in pixels the source is resized to for art of cols x rows characters.
+func (c *config) pixelSize(cols, rows int) (int, int) {
+	cellW, cellH := generator.CellSize(c.mode)
+	return cols * cellW, rows * cellH
+}
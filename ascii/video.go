@@ -0,0 +1,335 @@
+package ascii
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// Frame is one frame of converted video and how long it is shown. A stream of frames that fails ends with a
+// frame holding only the error.
+type Frame = utils.Frame
+
+// Video is a video opened with ffmpeg, ready to be converted.
+type Video struct {
+	Path      string        // Path of the video file, which is downloaded first for YouTube links
+	Name      string        // Name of the video file without its extension, "stdin" for a stream
+	Width     int           // Width of the video in pixels
+	Height    int           // Height of the video in pixels
+	FrameRate float64       // Native frame rate, 12 if the video doesn't tell
+	Duration  time.Duration // 0 if the video doesn't tell
+	HasAudio  bool
+	HasAlpha  bool // The frames have an alpha channel, drawn as Options.Alpha says
+
+	data *utils.VideoData
+}
+
+func newVideo(data *utils.VideoData) *Video {
+	return &Video{
+		Path:      data.Path,
+		Name:      data.FileName,
+		Width:     data.Width,
+		Height:    data.Height,
+		FrameRate: data.Fps,
+		Duration:  data.Duration,
+		HasAudio:  data.HasAudio,
+		HasAlpha:  data.HasAlpha,
+		data:      data,
+	}
+}
+
+// OpenVideo opens a video file, an http(s) URL or a YouTube link. It needs ffmpeg, and yt-dlp for YouTube.
+// Cancelling ctx stops the download and the probing of the video.
+func OpenVideo(ctx context.Context, path string) (*Video, error) {
+	data, err := utils.LoadVideo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newVideo(data), nil
+}
+
+// OpenVideoReader opens a video streamed from r. Formats that need seeking, like MP4 files with the index at
+// the end, can't be streamed and have to be opened with OpenVideo.
+func OpenVideoReader(ctx context.Context, r io.Reader) (*Video, error) {
+	data, err := utils.LoadVideoReader(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return newVideo(data), nil
+}
+
+/*
+	Frames starts converting the video and returns its frames in order, at Options.FrameRate or the native
+	frame rate of the video. The channel is closed after the last frame. Cancelling ctx stops ffmpeg and closes
+	the channel early, without an error frame. A video can only be converted once.
+*/
+func (v *Video) Frames(ctx context.Context, opts Options) (<-chan Frame, error) {
+	c, err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := GridSize(v.Width, v.Height, opts)
+	width, height := c.pixelSize(cols, rows)
+
+	frameRate := opts.FrameRate
+	if frameRate <= 0 {
+		frameRate = v.FrameRate
+	}
+	duration := time.Duration(float64(time.Second) / frameRate)
+
+	// ffmpeg scales the frames to the pixel grid and writes them as raw gray8, rgb24 when colors are needed, or
+	// rgba when the video has an alpha channel
+	pixelFormat := utils.PixelRGB
+	switch {
+	case v.HasAlpha:
+		pixelFormat = utils.PixelRGBA
+	case c.colorMode == generator.ColorNone:
+		pixelFormat = utils.PixelGray
+	}
+
+	// ffmpeg turns the frames too, before scaling them
+	utils.ExtractFrames(ctx, v.data, width, height, pixelFormat, c.orientation, c.filter, frameRate)
+	frameConfig := *c
+	frameConfig.orientation = utils.OrientNormal
+
+	produce := func(send func(image.Image, time.Duration) bool) error {
+		// ffmpeg is killed with ctx, closing the reader also unblocks a read while it is still feeding on stdin
+		defer v.data.Reader.Close()
+		stop := context.AfterFunc(ctx, func() {
+			v.data.Reader.Close()
+		})
+		defer stop()
+
+		return readRawFrames(v.data.Reader, width, height, pixelFormat, duration, send)
+	}
+
+	return convertFrames(ctx, produce, width, height, &frameConfig), nil
+}
+
+// FromVideo converts a video streamed from r. See OpenVideoReader and Video.Frames.
+func FromVideo(ctx context.Context, r io.Reader, opts Options) (<-chan Frame, error) {
+	video, err := OpenVideoReader(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return video.Frames(ctx, opts)
+}
+
+// FromVideoFile converts a video file, an http(s) URL or a YouTube link. See OpenVideo and Video.Frames.
+func FromVideoFile(ctx context.Context, path string, opts Options) (<-chan Frame, error) {
+	video, err := OpenVideo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return video.Frames(ctx, opts)
+}
+
+// FromAnimation converts the frames of an animation, each shown for its own duration. All frames must have
+// the size of the first one.
+func FromAnimation(ctx context.Context, frames []image.Image, durations []time.Duration, opts Options) (<-chan Frame, error) {
+	if len(frames) == 0 || len(frames) != len(durations) {
+		return nil, fmt.Errorf("animation error: %d frames and %d durations", len(frames), len(durations))
+	}
+
+	c, err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := GridSize(frames[0].Bounds().Dx(), frames[0].Bounds().Dy(), opts)
+	width, height := c.pixelSize(cols, rows)
+
+	produce := func(send func(image.Image, time.Duration) bool) error {
+		for i, frame := range frames {
+			if !send(frame, durations[i]) {
+				break
+			}
+		}
+		return nil
+	}
+
+	return convertFrames(ctx, produce, width, height, c), nil
+}
+
+/*
+	FromAnimatedImage converts an animated GIF, APNG or WebP loaded with utils.LoadImage. Every frame is decoded
+	and composited only when the conversion gets to it, so like a video it never holds more than a few frames.
+*/
+func FromAnimatedImage(ctx context.Context, animation *utils.Animation, opts Options) (<-chan Frame, error) {
+	c, err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := GridSize(animation.Width, animation.Height, opts)
+	width, height := c.pixelSize(cols, rows)
+
+	return convertFrames(ctx, animation.Composite, width, height, c), nil
+}
+
+// A decoded frame, numbered in stream order.
+type sourceFrame struct {
+	index    int
+	image    image.Image
+	duration time.Duration
+}
+
+// A converted frame, numbered in stream order.
+type convertedFrame struct {
+	index int
+	frame Frame
+}
+
+/*
+	convertFrames converts frames while they are being decoded and returns them in order.
+
+	1) produce decodes the frames and calls send for each of them in order, in its own goroutine.
+
+	2) A pool of workers converts the frames concurrently.
+
+	3) The results are put back in order before they are sent out.
+
+	send blocks while window frames are between produce and the consumer, so memory use doesn't grow with the
+	number of frames. It returns false once ctx is cancelled. An error returned by produce is sent as the last
+	frame.
+*/
+func convertFrames(ctx context.Context, produce func(send func(image.Image, time.Duration) bool) error, width, height int, c *config) <-chan Frame {
+	workers := runtime.NumCPU()
+
+	var (
+		jobs       = make(chan sourceFrame, workers)
+		results    = make(chan convertedFrame, workers)
+		window     = make(chan struct{}, 2*workers)
+		frames     = make(chan Frame, workers)
+		produceErr error
+	)
+
+	go func() {
+		defer close(jobs)
+
+		index := 0
+		produceErr = produce(func(img image.Image, duration time.Duration) bool {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+
+			jobs <- sourceFrame{index: index, image: img, duration: duration}
+			index++
+			return true
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- convertedFrame{
+					index: job.index,
+					frame: Frame{ASCII: render(job.image, width, height, c), Duration: job.duration},
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer close(frames)
+
+		pending := make(map[int]Frame)
+		next := 0
+
+		for result := range results {
+			if ctx.Err() != nil {
+				continue // drain the workers
+			}
+
+			pending[result.index] = result.frame
+			for frame, ok := pending[next]; ok; frame, ok = pending[next] {
+				delete(pending, next)
+				select {
+				case frames <- frame:
+				case <-ctx.Done():
+				}
+				<-window
+				next++
+			}
+		}
+
+		// produce is done once results is closed. Reading stops with a cancelled context, it is no error.
+		if produceErr != nil && ctx.Err() == nil {
+			select {
+			case frames <- Frame{Err: produceErr}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return frames
+}
+
+// readRawFrames reads fixed-size gray8, rgb24 or rgba frames from the ffmpeg stream and sends them in stream order.
+func readRawFrames(reader io.Reader, width, height int, pixelFormat string, duration time.Duration, send func(image.Image, time.Duration) bool) error {
+	frameSize := width * height
+	switch pixelFormat {
+	case utils.PixelRGB:
+		frameSize *= 3
+	case utils.PixelRGBA:
+		frameSize *= 4
+	}
+
+	for {
+		data := make([]byte, frameSize)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading raw video stream: %w", err)
+		}
+
+		if !send(frameImage(data, width, height, pixelFormat), duration) {
+			return nil
+		}
+	}
+}
+
+// frameImage wraps the bytes of a raw gray8, rgb24 or rgba frame in an image. The alpha of rgba isn't
+// premultiplied.
+func frameImage(data []byte, width, height int, pixelFormat string) image.Image {
+	rect := image.Rect(0, 0, width, height)
+	switch pixelFormat {
+	case utils.PixelGray:
+		return &image.Gray{Pix: data, Stride: width, Rect: rect}
+	case utils.PixelRGBA:
+		return &image.NRGBA{Pix: data, Stride: width * 4, Rect: rect}
+	}
+
+	img := image.NewRGBA(rect)
+	for i, j := 0, 0; i < len(data); i, j = i+3, j+4 {
+		img.Pix[j] = data[i]
+		img.Pix[j+1] = data[i+1]
+		img.Pix[j+2] = data[i+2]
+		img.Pix[j+3] = 255
+	}
+
+	return img
+}
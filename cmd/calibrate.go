@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/spf13/cobra"
+)
+
+const DefaultFontSize = 48
+
+type CalibrateCommand struct {
+	Font     string
+	FontSize int
+	Chars    string
+	Levels   int
+	Name     string
+	Output   string
+}
+var calibrateFlags CalibrateCommand
+
+// Raw value of --charset for the calibrate command.
+var calibrateCharsetArg string
+
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Sort a character set by the ink each character uses in a font.",
+	Long: "Rasterizes every character of a charset with a TrueType/OpenType font (Go Mono by default), measures how much of the cell it covers\n" +
+		"and prints the charset sorted from the least to the most ink as a charset file, with the measured densities.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		loadCharsetFiles(cmd)
+
+		var charset int
+		if !checkCharset(cmd, calibrateCharsetArg, &calibrateFlags.Chars, &charset) {
+			os.Exit(1)
+		}
+
+		if calibrateFlags.FontSize < 8 {
+			cmd.PrintErrf("The font size should be at least 8 pixels.\n")
+			os.Exit(1)
+		}
+
+		face, err := generator.LoadFace(calibrateFlags.Font, float64(calibrateFlags.FontSize))
+		if err != nil {
+			cmd.PrintErrf("%v\n", err)
+			os.Exit(1)
+		}
+		defer face.Close()
+
+		glyphs := generator.GetCharsets()[charset-1]
+		result, err := generator.Calibrate(face, glyphs, calibrateFlags.Levels)
+		if err != nil {
+			cmd.PrintErrf("Calibration failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(result.Missing) > 0 {
+			cmd.PrintErrf("The font has no glyph for: %s\n", strings.Join(result.Missing, " "))
+		}
+
+		content := formatCharsetFile(result, charsetSource(charset))
+		if calibrateFlags.Output == "" {
+			fmt.Print(content)
+			return
+		}
+
+		if err := os.WriteFile(calibrateFlags.Output, []byte(content), 0644); err != nil {
+			cmd.PrintErrf("Error saving the charset file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved the calibrated charset to %s\n", calibrateFlags.Output)
+	},
+}
+
+func init() {
+	calibrateCmd.Flags().StringVarP(&calibrateFlags.Font, "font", "f", "", "Path to a TrueType/OpenType font. Default is the bundled Go Mono.")
+	calibrateCmd.Flags().IntVar(&calibrateFlags.FontSize, "size", DefaultFontSize, "Font size in pixels used for measuring.")
+	calibrateCmd.Flags().StringVarP(&calibrateCharsetArg, "charset", "c", strconv.Itoa(DefaultCharset), "Character set to calibrate, by number or name.")
+	calibrateCmd.Flags().StringVar(&calibrateFlags.Chars, "chars", "", "Characters to calibrate instead of a charset.")
+	calibrateCmd.Flags().IntVarP(&calibrateFlags.Levels, "levels", "l", 0, "Keep only this many characters, as evenly spaced in density as possible. Default keeps all.")
+	calibrateCmd.Flags().StringVarP(&calibrateFlags.Name, "name", "n", "calibrated", "Name written to the charset file.")
+	calibrateCmd.Flags().StringVarP(&calibrateFlags.Output, "output", "o", "", "Save the charset file to this path, e.g. ~/.config/goskii/charsets/mine.charset. Default prints it.")
+}
+
+/*
+	Describes the calibrated characters for the charset file: the --chars ramp, a charset file by name or a
+	built-in charset by number. --chars is registered as a charset too, but its number means nothing to the user.
+*/
+func charsetSource(charset int) string {
+	if calibrateFlags.Chars != "" {
+		return "the --chars ramp"
+	}
+
+	for _, custom := range generator.GetCustomCharsets() {
+		if custom.Number == charset {
+			return fmt.Sprintf("charset \"%s\"", custom.Name)
+		}
+	}
+
+	return fmt.Sprintf("charset %d", charset)
+}
+
+// Formats a calibration in the charset file format. source describes the characters calibrated.
+func formatCharsetFile(result generator.Calibration, source string) string {
+	var builder strings.Builder
+
+	font := calibrateFlags.Font
+	if font == "" {
+		font = "Go Mono"
+	}
+
+	densities := make([]string, len(result.Densities))
+	for i, d := range result.Densities {
+		densities[i] = strconv.FormatFloat(d, 'f', 3, 64)
+	}
+
+	fmt.Fprintf(&builder, "# Generated by goskii calibrate from %s with %s\n", source, font)
+	fmt.Fprintf(&builder, "name: %s\n", calibrateFlags.Name)
+	fmt.Fprintf(&builder, "description: Characters of %s sorted by measured density.\n", source)
+	fmt.Fprintf(&builder, "ramp: %s\n", strconv.Quote(strings.Join(result.Glyphs, "")))
+	fmt.Fprintf(&builder, "direction: light-to-dark\n")
+	fmt.Fprintf(&builder, "densities: %s\n", strings.Join(densities, " "))
+
+	return builder.String()
+}
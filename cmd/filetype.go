@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/JoelVCrasta/goskii/utils"
+	"golang.org/x/term"
+)
+
+// Number of bytes read from the start of a file to detect its type.
+const sniffLength = 512
+
+// File type of the -p path detected by checkFilePath (0 image, 1 video, 3 YouTube, -1 unsupported).
+var fileType = -1
+
+/*
+	sniffType returns the file type (0 image, 1 video) from the magic bytes at the start of a file, or -1 if the
+	format is not recognized.
+*/
+func sniffType(header []byte) int {
+	hasPrefix := func(prefix string) bool {
+		return bytes.HasPrefix(header, []byte(prefix))
+	}
+	riff := func(format string) bool {
+		return len(header) >= 12 && hasPrefix("RIFF") && string(header[8:12]) == format
+	}
+
+	switch {
+	case hasPrefix("\xFF\xD8\xFF"), // JPEG
+		hasPrefix("\x89PNG\r\n\x1a\n"),
+		hasPrefix("GIF87a"), hasPrefix("GIF89a"),
+		riff("WEBP"),
+		hasPrefix("BM"),
+		hasPrefix("II*\x00"), hasPrefix("MM\x00*"): // TIFF
+		return 0
+	case len(header) >= 8 && string(header[4:8]) == "ftyp", // MP4, MOV, 3GP
+		hasPrefix("\x1A\x45\xDF\xA3"), // Matroska and WebM
+		riff("AVI "),
+		hasPrefix("FLV"),
+		hasPrefix("\x00\x00\x01\xBA"), hasPrefix("\x00\x00\x01\xB3"), // MPEG program stream and video
+		hasPrefix("\x30\x26\xB2\x75\x8E\x66\xCF\x11"), // ASF (WMV)
+		len(header) > 188 && header[0] == 0x47 && header[188] == 0x47: // MPEG transport stream
+		return 1
+	default:
+		return -1
+	}
+}
+
+// contentTypeKind returns the file type (0 image, 1 video) of an HTTP Content-Type, or -1 if it is neither.
+func contentTypeKind(contentType string) int {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return 0
+	case strings.HasPrefix(contentType, "video/"):
+		return 1
+	default:
+		return -1
+	}
+}
+
+// sniffFile detects the type of a local file from its content, falling back to its extension.
+func sniffFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return -1, err
+	}
+
+	if kind := sniffType(header[:n]); kind != -1 {
+		return kind, nil
+	}
+
+	return checkExtension(path), nil
+}
+
+/*
+	sniffURL detects the type of the file at an HTTP URL. Only the start of the file is requested. Its magic
+	bytes decide, then the Content-Type of the response, then the extension of the URL path.
+*/
+func sniffURL(rawURL, urlPath string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", sniffLength-1))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return -1, fmt.Errorf("status code %d", res.StatusCode)
+	}
+
+	// Servers that ignore the range send the whole file, only the start is read
+	header, err := io.ReadAll(io.LimitReader(res.Body, sniffLength))
+	if err != nil {
+		return -1, err
+	}
+
+	if kind := sniffType(header); kind != -1 {
+		return kind, nil
+	}
+	if kind := contentTypeKind(res.Header.Get("Content-Type")); kind != -1 {
+		return kind, nil
+	}
+
+	return checkExtension(urlPath), nil
+}
+
+// sniffStdin detects the type of the data piped into stdin from its content, without consuming it.
+func sniffStdin() (int, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return -1, fmt.Errorf("nothing is piped into stdin")
+	}
+
+	header, err := utils.PeekStdin(sniffLength)
+	if err != nil {
+		return -1, err
+	}
+
+	return sniffType(header), nil
+}
@@ -2,14 +2,15 @@ package cmd
 
 import (
 	"fmt"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
 	"github.com/kkdai/youtube/v2"
 	"github.com/spf13/cobra"
 )
@@ -21,8 +22,14 @@ const (
     DefaultCharset  = 1
     MinCharset      = 1
     MaxCharset      = 13
+	DefaultThreshold = 128
+	DefaultEdgeThreshold = 64
+	DefaultAlphaThreshold = 128
+	DefaultMaxMegapixels = 200
+	DefaultMaxInputMB = 512
+	DefaultOutputFontSize = 16
 	MinFps			= 1
-	MaxFps			= 24
+	MaxFps			= 60
 	DefaultFps		= 12
 	Version 		= "2.0"
 )
@@ -34,9 +41,31 @@ type Command struct {
 	Size  			int
 	Charset 		int
 	Fps 			int
+	Color 			string
+	Mode 			string
+	Threshold 		int
+	Dither 			string
+	Filter 			string
+	EdgeThreshold 	int
+	EdgeOperator 	string
+	Chars 			string
+	Font 			string
+	FontSize 		int
+	Foreground 		string
+	Background 		string
+	Alpha 			string
+	AlphaThreshold 	int
+	Rotate 			int
+	Flip 			string
+	MaxMegapixels 	int
+	MaxInputMB 		int
+	Audio 			bool
 }
 var cmdFlags Command
 
+// Raw value of --charset, a number or the name of a custom charset. Resolved into cmdFlags.Charset.
+var charsetArg string
+
 var rootCmd = &cobra.Command{
 	Use:  "goskii",
 	Short: "goskii is a CLI tool to convert images to ASCII art.",
@@ -48,6 +77,8 @@ var rootCmd = &cobra.Command{
 			os.Exit(0)
 		}
 
+		loadCharsetFiles(cmd)
+
 		if cmd.Flags().Changed("showset") {
 			showShowset()
 			os.Exit(0)
@@ -70,28 +101,80 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if !checkCharset(cmd, &cmdFlags.Charset) {
+		if !checkCharset(cmd, charsetArg, &cmdFlags.Chars, &cmdFlags.Charset) {
 			os.Exit(1)
 		}
 
 		if !checkFps(cmd, &cmdFlags.Fps, &cmdFlags.Path, &cmdFlags.Render) {
 			os.Exit(1)
 		}
+
+		if !checkColor(cmd, &cmdFlags.Color) {
+			os.Exit(1)
+		}
+
+		if !checkMode(cmd, &cmdFlags.Mode, &cmdFlags.Threshold, &cmdFlags.EdgeThreshold, &cmdFlags.EdgeOperator) {
+			os.Exit(1)
+		}
+
+		if !checkDither(cmd, &cmdFlags.Dither) {
+			os.Exit(1)
+		}
+
+		if !checkFilter(cmd, &cmdFlags.Filter) {
+			os.Exit(1)
+		}
+
+		if !checkAlpha(cmd, &cmdFlags.Alpha, &cmdFlags.AlphaThreshold) {
+			os.Exit(1)
+		}
+
+		if !checkOrientation(cmd, &cmdFlags.Rotate, &cmdFlags.Flip) {
+			os.Exit(1)
+		}
+
+		if !checkLimits(cmd, &cmdFlags.MaxMegapixels, &cmdFlags.MaxInputMB) {
+			os.Exit(1)
+		}
+
+		if !checkFont(cmd, &cmdFlags.Font, &cmdFlags.FontSize, &cmdFlags.Foreground, &cmdFlags.Background) {
+			os.Exit(1)
+		}
 	},
 }
 
 func Execute() {
-	rootCmd.Flags().StringVarP(&cmdFlags.Path, "path", "p", "","Path to the file. (Required)")
-    rootCmd.Flags().StringVarP(&cmdFlags.Output, "output", "o", "", "Output folder path. Default is current directory.")
-	rootCmd.Flags().StringVarP(&cmdFlags.Render, "render", "r", "", "Render the contents of the ASCII art file.")
+	rootCmd.Flags().StringVarP(&cmdFlags.Path, "path", "p", "","Path or URL of the image or video, or - to read it from stdin. (Required)")
+    rootCmd.Flags().StringVarP(&cmdFlags.Output, "output", "o", "", "Output folder path, or a .png, .gif, .mp4 or .webm file to render the art to, or a .gsk file to save it to.")
+	rootCmd.Flags().StringVarP(&cmdFlags.Render, "render", "r", "", "Render the contents of the ASCII art file (.gsk or .txt).")
     rootCmd.Flags().IntVarP(&cmdFlags.Size, "width", "w", DefaultSize, fmt.Sprintf("Width of the ASCII art (%d - %d). Default adjusts to terminal size.", MinSize, MaxSize))
-    rootCmd.Flags().IntVarP(&cmdFlags.Charset, "charset", "c", DefaultCharset, fmt.Sprintf("Character set to use (%d - %d).", MinCharset, MaxCharset))
-	rootCmd.Flags().IntVarP(&cmdFlags.Fps, "fps", "f", 12, fmt.Sprintf("Video FPS (%d - %d). Default is %d.", MinFps, MaxFps, DefaultFps))
+    rootCmd.Flags().StringVarP(&charsetArg, "charset", "c", strconv.Itoa(DefaultCharset), fmt.Sprintf("Character set to use (%d - %d), or the name of a charset file.", MinCharset, MaxCharset))
+	rootCmd.Flags().StringVar(&cmdFlags.Chars, "chars", "", "Custom character ramp from the least to the most ink, e.g. \" .:-=+*#%@\". Overrides --charset.")
+	rootCmd.Flags().IntVarP(&cmdFlags.Fps, "fps", "f", 0, fmt.Sprintf("Video FPS (%d - %d). Default is the frame rate of the source, or %d when rendering a file.", MinFps, MaxFps, DefaultFps))
+	rootCmd.Flags().StringVar(&cmdFlags.Color, "color", "", "Color mode of the ASCII art (16, 256, truecolor). Default is no color.")
+	rootCmd.Flags().StringVarP(&cmdFlags.Mode, "mode", "m", "ascii", "Render mode (ascii, braille, halfblock, edges, shape).")
+	rootCmd.Flags().IntVar(&cmdFlags.Threshold, "threshold", DefaultThreshold, "Brightness (0 - 255) at which a braille dot is raised.")
+	rootCmd.Flags().StringVarP(&cmdFlags.Dither, "dither", "d", "", "Dithering (none, fs, atkinson, jjn, bayer2, bayer4, bayer8). Default is none for images and bayer4 for videos.")
+	rootCmd.Flags().StringVar(&cmdFlags.Filter, "filter", "auto", "Resampling filter (auto, box, bilinear, lanczos3, mitchell, nearest). Default is box when shrinking and bilinear when enlarging.")
+	rootCmd.Flags().IntVar(&cmdFlags.EdgeThreshold, "edge-threshold", DefaultEdgeThreshold, "Edge strength (0 - 255) at which the edges mode draws a directional character.")
+	rootCmd.Flags().StringVar(&cmdFlags.EdgeOperator, "edge-operator", "sobel", "Edge detection operator for the edges mode (sobel, scharr).")
+	rootCmd.Flags().StringVar(&cmdFlags.Font, "font", "", "TrueType/OpenType font used by the shape mode and for rendered output. Default is the bundled Go Mono.")
+	rootCmd.Flags().IntVar(&cmdFlags.FontSize, "font-size", DefaultOutputFontSize, "Font size in pixels of rendered output (.png, .gif, .mp4, .webm).")
+	rootCmd.Flags().StringVar(&cmdFlags.Foreground, "fg", "#ffffff", "Text color of rendered output, for uncolored characters.")
+	rootCmd.Flags().StringVar(&cmdFlags.Background, "bg", "#000000", "Background color of rendered output, and of transparent pixels with --alpha background.")
+	rootCmd.Flags().StringVar(&cmdFlags.Alpha, "alpha", "blank", "How transparent pixels are drawn (blank, threshold, background).")
+	rootCmd.Flags().IntVar(&cmdFlags.AlphaThreshold, "alpha-threshold", DefaultAlphaThreshold, "Opacity (0 - 255) below which a character is left blank with --alpha threshold.")
+	rootCmd.Flags().IntVar(&cmdFlags.Rotate, "rotate", 0, "Rotate the image or video clockwise (0, 90, 180, 270), after its EXIF orientation.")
+	rootCmd.Flags().StringVar(&cmdFlags.Flip, "flip", "none", "Flip the image or video after rotating it (none, horizontal, vertical).")
+	rootCmd.Flags().IntVar(&cmdFlags.MaxMegapixels, "max-megapixels", DefaultMaxMegapixels, "Largest image to decode, in megapixels, or 0 for no limit. Larger JPEGs are decoded at a smaller size.")
+	rootCmd.Flags().IntVar(&cmdFlags.MaxInputMB, "max-input", DefaultMaxInputMB, "Largest image to read or download, in MB, or 0 for no limit.")
+	rootCmd.Flags().BoolVar(&cmdFlags.Audio, "audio", false, "Mux the audio of the source video into .mp4 and .webm output.")
     rootCmd.Flags().BoolP("showset", "s", false, "Display all character sets.")
 	rootCmd.Flags().BoolP("version", "v", false, "Verion of goskii.")
 	rootCmd.MarkPersistentFlagRequired("path")
 	
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
+	rootCmd.AddCommand(calibrateCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		rootCmd.PrintErrln(err)
@@ -104,12 +187,12 @@ func GetCommands() Command {
 	return cmdFlags
 }
 
-// Returns the file type (image or video)
+// Returns the file type (image or video) detected from the content of the file.
 func GetFileType() int {
-	return checkExtension(cmdFlags.Path)
+	return fileType
 }
 
-// Checks whether the file extension is supported.
+// Returns the file type from the extension, the fallback when the content can't tell.
 func checkExtension(path string) int {
 	ext := strings.ToLower(filepath.Ext(path))
 	youtubeRegex := regexp.MustCompile(`https?:\/\/(www\.)?(youtube\.com|youtu\.be)\/`)
@@ -129,12 +212,28 @@ func checkExtension(path string) int {
 	}
 }
 
-// Checks whether the file path is valid and the file extension is supported.
+// Checks whether the file path is valid and the file is an image or a video.
 func checkFilePath(cmd *cobra.Command, path *string) bool {
 	if *path == "" {
 		return false
 	}
 
+	// Read the image or video from stdin
+	if *path == utils.StdinPath {
+		kind, err := sniffStdin()
+		if err != nil {
+			cmd.PrintErrf("Error reading stdin: %v\n", err)
+			return false
+		}
+		if kind == -1 {
+			cmd.PrintErrf("The data on stdin is not a supported image or video.\n")
+			return false
+		}
+
+		fileType = kind
+		return true
+	}
+
 	// Check if the path is a valid URL
 	parsedURL, err := url.ParseRequestURI(*path)
 	if err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") {
@@ -147,23 +246,22 @@ func checkFilePath(cmd *cobra.Command, path *string) bool {
 				cmd.PrintErrf("Error fetching the YouTube video: %v\n", err)
 				return false
 			}
+			fileType = 3
 			return true
 		}
 
 		// Handle non-YouTube URLs (e.g., images or videos)
-		res, err := http.Head(*path)
+		kind, err := sniffURL(*path, parsedURL.Path)
 		if err != nil {
 			cmd.PrintErrf("Error fetching the URL \"%s\": %v\n", *path, err)
 			return false
 		}
-		defer res.Body.Close()
-
-		contentType := res.Header.Get("Content-Type")
-		if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") {
+		if kind != 0 && kind != 1 {
 			cmd.PrintErrf("The URL \"%s\" does not point to an image or a video.\n", *path)
 			return false
 		}
 
+		fileType = kind
 		return true
 	}
 
@@ -173,14 +271,30 @@ func checkFilePath(cmd *cobra.Command, path *string) bool {
 		return false
 	}
 
-	if checkExtension(*path) == -1 {
-		cmd.PrintErrf("The file extension is not supported.\n")
+	kind, err := sniffFile(*path)
+	if err != nil {
+		cmd.PrintErrf("Error reading the file \"%s\": %v\n", *path, err)
+		return false
+	}
+	if kind != 0 && kind != 1 {
+		cmd.PrintErrf("The file type is not supported.\n")
 		return false
 	}
 
+	fileType = kind
 	return true
 }
 
+// Returns whether the output path is a file the art is rendered or saved to instead of a folder for a text file.
+func isRenderedOutput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".gif", ".mp4", ".webm", ".gsk":
+		return true
+	default:
+		return false
+	}
+}
+
 // Checks whether the output path is valid and a directory.
 func checkOutputPath(cmd *cobra.Command, path *string) bool {
 	if *path == "" {
@@ -197,6 +311,16 @@ func checkOutputPath(cmd *cobra.Command, path *string) bool {
         return true
     }
 
+	// A rendered output path is a file to create, only the folder it goes in has to exist
+	if isRenderedOutput(*path) {
+		dir := filepath.Dir(*path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			cmd.PrintErrf("The output folder \"%s\" does not exist.\n", dir)
+			return false
+		}
+		return true
+	}
+
     info, err := os.Stat(*path)
     if os.IsNotExist(err) {
         cmd.PrintErrf("The output folder \"%s\" does not exist.\n", *path)
@@ -223,7 +347,7 @@ func checkRender(cmd *cobra.Command, path *string) bool {
 		return false
 	}
 
-	if filepath.Ext(*path) != ".txt" {
+	if ext := filepath.Ext(*path); ext != ".txt" && ext != ".gsk" {
 		cmd.PrintErrf("The file extension is not supported.\n")
 		return false
 	}
@@ -241,13 +365,51 @@ func checkSize(cmd *cobra.Command, size *int) bool {
 	return true
 }
 
-// Checks whether the charset is between 1 and 10.
-func checkCharset(cmd *cobra.Command, charset *int) bool {
-	if *charset < MinCharset || *charset > MaxCharset {
-		cmd.PrintErrf("The charset should be between %d and %d.\n", MinCharset, MaxCharset)
+// Loads the user charset files, reporting the ones that could not be read.
+func loadCharsetFiles(cmd *cobra.Command) {
+	dir, err := generator.CharsetDir()
+	if err != nil {
+		return
+	}
+
+	if err := generator.LoadCharsetDir(dir); err != nil {
+		cmd.PrintErrf("Skipping invalid charset files:\n%v\n", err)
+	}
+}
+
+/*
+	Resolves the charset to a number. A --chars ramp is added as a new charset and takes priority,
+	otherwise --charset is either a number (1 - 13, or higher for charset files) or the name of a charset file.
+*/
+func checkCharset(cmd *cobra.Command, arg string, chars *string, charset *int) bool {
+	if *chars != "" {
+		number, err := generator.AddCharset("chars", "Custom characters from --chars.", generator.SplitGlyphs(*chars))
+		if err != nil {
+			cmd.PrintErrf("Invalid --chars: %v\n", err)
+			return false
+		}
+		*charset = number
+		return true
+	}
+
+	if number, found := generator.FindCharset(arg); found {
+		*charset = number
+		return true
+	}
+
+	maxCharset := len(generator.GetCharsets())
+	number, err := strconv.Atoi(arg)
+	if err != nil {
+		cmd.PrintErrf("The charset \"%s\" was not found. Use --showset to list all character sets.\n", arg)
 		return false
 	}
 
+	if number < MinCharset || number > maxCharset {
+		cmd.PrintErrf("The charset should be between %d and %d.\n", MinCharset, maxCharset)
+		return false
+	}
+
+	*charset = number
 	return true
 }
 
@@ -257,19 +419,142 @@ func checkFps(cmd *cobra.Command, fps *int, path *string, render *string) bool {
 		return false
 	}
 
-	if checkExtension(*path) != 1 && checkExtension(*render) != 2 && strings.Contains(*path, "youtube.com") {
-		cmd.PrintErrf("Not a video file.\n")
+	// 0 keeps the frame rate of the source
+	if *fps != 0 && (*fps < MinFps || *fps > MaxFps) {
+		cmd.PrintErrf("The FPS should be between %d and %d.\n", MinFps, MaxFps)
 		return false
 	}
 
-	if *fps < MinFps || *fps > MaxFps {
-		cmd.PrintErrf("The FPS should be between %d and %d.\n", MinFps, MaxFps)
+	return true
+}
+
+// Checks whether the color mode is one of the supported modes.
+func checkColor(cmd *cobra.Command, color *string) bool {
+	if _, err := generator.ParseColorMode(*color); err != nil {
+		cmd.PrintErrf("The color mode should be one of 16, 256 or truecolor.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the render mode is supported and its thresholds and edge operator are valid.
+func checkMode(cmd *cobra.Command, mode *string, threshold, edgeThreshold *int, edgeOperator *string) bool {
+	if _, err := generator.ParseRenderMode(*mode); err != nil {
+		cmd.PrintErrf("The mode should be one of ascii, braille, halfblock, edges or shape.\n")
+		return false
+	}
+
+	if *threshold < 0 || *threshold > 255 {
+		cmd.PrintErrf("The threshold should be between 0 and 255.\n")
+		return false
+	}
+
+	if *edgeThreshold < 0 || *edgeThreshold > 255 {
+		cmd.PrintErrf("The edge threshold should be between 0 and 255.\n")
+		return false
+	}
+
+	*edgeOperator = strings.ToLower(*edgeOperator)
+	if *edgeOperator != "sobel" && *edgeOperator != "scharr" {
+		cmd.PrintErrf("The edge operator should be either sobel or scharr.\n")
 		return false
 	}
 
 	return true
 }
 
+// Checks whether the dither mode is supported.
+func checkDither(cmd *cobra.Command, dither *string) bool {
+	if _, err := generator.ParseDitherMode(*dither); err != nil {
+		cmd.PrintErrf("The dither mode should be one of none, fs, atkinson, jjn, bayer2, bayer4 or bayer8.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the resampling filter is supported.
+func checkFilter(cmd *cobra.Command, filter *string) bool {
+	if _, err := utils.ParseFilter(*filter); err != nil {
+		cmd.PrintErrf("The filter should be one of auto, box, bilinear, lanczos3, mitchell or nearest.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the alpha mode is supported and the alpha threshold is valid.
+func checkAlpha(cmd *cobra.Command, alpha *string, alphaThreshold *int) bool {
+	if _, err := generator.ParseAlphaMode(*alpha); err != nil {
+		cmd.PrintErrf("The alpha mode should be one of blank, threshold or background.\n")
+		return false
+	}
+
+	if *alphaThreshold < 0 || *alphaThreshold > 255 {
+		cmd.PrintErrf("The alpha threshold should be between 0 and 255.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the rotation is a quarter turn and the flip is supported.
+func checkOrientation(cmd *cobra.Command, rotate *int, flip *string) bool {
+	switch *rotate {
+	case 0, 90, 180, 270:
+	default:
+		cmd.PrintErrf("The rotation should be one of 0, 90, 180 or 270.\n")
+		return false
+	}
+
+	if _, err := utils.ParseFlip(*flip); err != nil {
+		cmd.PrintErrf("The flip should be one of none, horizontal or vertical.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the limits on the size of images are valid.
+func checkLimits(cmd *cobra.Command, maxMegapixels, maxInputMB *int) bool {
+	if *maxMegapixels < 0 {
+		cmd.PrintErrf("The maximum megapixels should be 0 or more.\n")
+		return false
+	}
+
+	if *maxInputMB < 0 {
+		cmd.PrintErrf("The maximum input size should be 0 or more.\n")
+		return false
+	}
+
+	return true
+}
+
+// Checks whether the font file exists and the options of rendered output are valid.
+func checkFont(cmd *cobra.Command, font *string, fontSize *int, fg, bg *string) bool {
+	if *font != "" {
+		if _, err := os.Stat(*font); err != nil {
+			cmd.PrintErrf("The font \"%s\" does not exist or is not valid.\n", *font)
+			return false
+		}
+	}
+
+	if *fontSize < 4 || *fontSize > 128 {
+		cmd.PrintErrf("The font size should be between 4 and 128.\n")
+		return false
+	}
+
+	for _, c := range []*string{fg, bg} {
+		if _, err := generator.ParseHexColor(*c); err != nil {
+			cmd.PrintErrf("The color \"%s\" should be written as #rrggbb.\n", *c)
+			return false
+		}
+	}
+
+	return true
+}
+
 // Displays all the character sets.
 func showShowset() {
 	charsetsDesc := map[int]string{
@@ -288,6 +573,14 @@ func showShowset() {
 		13: "Arrows (Unicode).",
 	}
 
+	for _, custom := range generator.GetCustomCharsets() {
+		desc := custom.Description
+		if desc == "" {
+			desc = "Custom charset."
+		}
+		charsetsDesc[custom.Number] = fmt.Sprintf("%s (-c %s)", desc, custom.Name)
+	}
+
 	charsets := generator.GetCharsets()
 	for i, set := range charsets {
 		setStr := strings.Join(set, " ")
@@ -295,5 +588,9 @@ func showShowset() {
 		fmt.Printf("%d) %s\n\n", i+1, setStr)
 	}
 
+	if dir, err := generator.CharsetDir(); err == nil {
+		fmt.Printf("Custom charsets are loaded from %s (*%s files).\n", dir, generator.CharsetFileExt)
+	}
+
 	fmt.Println("Note: The Unicode characters may not work in all terminals.")
 }
\ No newline at end of file
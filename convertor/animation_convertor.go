@@ -0,0 +1,55 @@
+package convertor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JoelVCrasta/goskii/ascii"
+	"github.com/JoelVCrasta/goskii/cmd"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// animationRate returns the frame rate .mp4 and .webm output of an animation is encoded at. It is --fps if set,
+// or one frame per shortest frame duration, up to the highest rate allowed by --fps.
+func animationRate(flags cmd.Command, durations []time.Duration) float64 {
+	if flags.Fps > 0 {
+		return float64(flags.Fps)
+	}
+
+	shortest := durations[0]
+	for _, duration := range durations[1:] {
+		shortest = min(shortest, duration)
+	}
+
+	return min(float64(time.Second)/float64(shortest), cmd.MaxFps)
+}
+
+// animationToASCII converts the frames of an animated GIF, APNG or WebP and plays or saves them like a video,
+// each frame with its own duration.
+func animationToASCII(ctx context.Context, flags cmd.Command, opts ascii.Options, imageData *utils.ImageData, shouldPrint bool) error {
+	opts.Dither = frameDither(flags, opts.Dither)
+
+	if strings.EqualFold(filepath.Ext(flags.Output), ".png") {
+		return fmt.Errorf("save error: PNG output is only supported for still images")
+	}
+
+	if !shouldPrint && flags.Output == "" {
+		return nil
+	}
+
+	convert := func(ctx context.Context) (<-chan ascii.Frame, error) {
+		return ascii.FromAnimatedImage(ctx, imageData.Animation, opts)
+	}
+
+	var total time.Duration
+	for _, duration := range imageData.Animation.Durations {
+		total += duration
+	}
+
+	return playAndSave(ctx, convert, total, flags, shouldPrint, func(frames <-chan utils.Frame) error {
+		return saveVideoOutput(frames, flags, artHeader(opts, imageData.FileName, animationRate(flags, imageData.Animation.Durations)), "")
+	})
+}
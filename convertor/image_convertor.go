@@ -1,77 +1,82 @@
 package convertor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"image"
+	"path/filepath"
+	"strings"
 
+	"github.com/JoelVCrasta/goskii/ascii"
 	"github.com/JoelVCrasta/goskii/cmd"
-	"github.com/JoelVCrasta/goskii/generator"
 	"github.com/JoelVCrasta/goskii/utils"
 )
 
-// Converts an image to grayscale, resizes it, and generates ASCII art.
-func convertImage(imageData *utils.ImageData, width, height, charset int, hasAlpha bool) string {
-	var imageGray *image.Gray
-	var alpha [][]uint8
-
-	if hasAlpha {
-		imageGray, alpha = utils.GrayscaleAlpha(imageData.Image)
-		alpha = utils.ResizeAlpha(alpha, imageData.Width, imageData.Height, width, height)
-	} else {
-		imageGray = utils.Grayscale(imageData.Image)
-	}
-
-	resizedImage := utils.ResizeGray(imageGray, width, height)
-
-	if hasAlpha {
-		return generator.GenerateASCIIAlpha(resizedImage, alpha, width, height, charset)
-	}
-	return generator.GenerateASCII(resizedImage, width, height, charset-1)
-}
-
-
 // Converts the image to ASCII by calling the appropriate function based on the image extension.
 func ImageToASCII(
+	ctx context.Context,
 	flags cmd.Command,
 ) error {
-	imageData, err := utils.LoadImage(flags.Path)
-	if err != nil {
-		return fmt.Errorf("load error: %v", err)
+	limits := utils.Limits{
+		MaxPixels: int64(flags.MaxMegapixels) * 1000000,
+		MaxBytes:  int64(flags.MaxInputMB) << 20,
 	}
 
-	width, height, err := utils.CalculateNewBounds(imageData.Width, imageData.Height, flags.Size)
-	if  err != nil {
-		return fmt.Errorf("bounds error: %v", err)
+	imageData, err := utils.LoadImage(ctx, flags.Path, limits)
+	if err != nil {
+		return fmt.Errorf("load error: %v%s", err, limitHint(err))
 	}
 
-	termW, termH, err := utils.GetTerminalSize()
+	opts, err := newOptions(flags, imageData.Width, imageData.Height)
 	if err != nil {
-		return fmt.Errorf("terminal size error: %v", err)
+		return err
 	}
 
-	shouldPrint := width <= termW && height <= termH
+	cols, rows := ascii.GridSize(imageData.Width, imageData.Height, opts)
+	shouldPrint, err := fitsOutput(cols, rows)
+	if err != nil {
+		return err
+	}
 	if !shouldPrint && flags.Output == "" {
 		fmt.Println("ASCII art is too large to fit in the terminal. Increase the terminal size or use the -o flag to save to a file.")
 	}
 
+	if imageData.Animation != nil {
+		return animationToASCII(ctx, flags, opts, imageData, shouldPrint)
+	}
+
+	switch strings.ToLower(filepath.Ext(flags.Output)) {
+	case ".gif", ".mp4", ".webm":
+		return fmt.Errorf("save error: GIF, MP4 and WebM output is only supported for videos and animated images")
+	}
 
-	var ascii string
-	if imageData.Extension == ".png" {
-		ascii = convertImage(imageData, width, height, flags.Charset, true)
-	} else {
-		ascii = convertImage(imageData, width, height, flags.Charset, false)
+	art, err := ascii.FromImage(imageData.Image, opts)
+	if err != nil {
+		return err
 	}
 
 	if shouldPrint {
-		fmt.Println(ascii)
+		fmt.Println(art)
 	}
 
 	if flags.Output != "" {
-		err := utils.SaveToTextFile(ascii, flags.Output, imageData.FileName)
+		err := saveImageOutput(art.Text, flags, artHeader(opts, imageData.FileName, 0))
 		if err != nil {
 			return fmt.Errorf("save error: %v", err)
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// limitHint returns the flag that raises the limit an error is about, to be appended to it.
+func limitHint(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrTooManyPixels):
+		return " (raise it with --max-megapixels)"
+	case errors.Is(err, utils.ErrTooManyBytes):
+		return " (raise it with --max-input)"
+	default:
+		return ""
+	}
+}
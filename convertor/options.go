@@ -0,0 +1,110 @@
+package convertor
+
+import (
+	"fmt"
+
+	"github.com/JoelVCrasta/goskii/ascii"
+	"github.com/JoelVCrasta/goskii/cmd"
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+/*
+	newOptions converts the flags to library options for a width x height pixel source. Without --size the art
+	fills the terminal, or is ascii.DefaultWidth characters wide when stdout is not a terminal.
+*/
+func newOptions(flags cmd.Command, width, height int) (ascii.Options, error) {
+	colorMode, err := generator.ParseColorMode(flags.Color)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("color error: %v", err)
+	}
+
+	mode, err := generator.ParseRenderMode(flags.Mode)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("mode error: %v", err)
+	}
+
+	dither, err := generator.ParseDitherMode(flags.Dither)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("dither error: %v", err)
+	}
+
+	filter, err := utils.ParseFilter(flags.Filter)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("filter error: %v", err)
+	}
+
+	alpha, err := generator.ParseAlphaMode(flags.Alpha)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("alpha error: %v", err)
+	}
+
+	flip, err := utils.ParseFlip(flags.Flip)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("flip error: %v", err)
+	}
+
+	background, err := generator.ParseHexColor(flags.Background)
+	if err != nil {
+		return ascii.Options{}, fmt.Errorf("color error: invalid background color \"%s\"", flags.Background)
+	}
+
+	opts := ascii.Options{
+		Width:          flags.Size,
+		Mode:           mode,
+		Color:          colorMode,
+		Charset:        flags.Charset,
+		Chars:          flags.Chars,
+		Dither:         dither,
+		Filter:         filter,
+		Threshold:      uint8(flags.Threshold),
+		EdgeThreshold:  uint8(flags.EdgeThreshold),
+		Scharr:         flags.EdgeOperator == "scharr",
+		Font:           flags.Font,
+		Alpha:          alpha,
+		AlphaThreshold: uint8(flags.AlphaThreshold),
+		Background:     background,
+		Rotate:         flags.Rotate,
+		Flip:           flip,
+		FrameRate:      float64(flags.Fps),
+	}
+
+	if flags.Size == 0 && utils.IsTerminal() {
+		// The art is as tall as the source is wide once it is turned on its side
+		if flags.Rotate == 90 || flags.Rotate == 270 {
+			width, height = height, width
+		}
+
+		opts.Width, opts.Height, err = utils.FitTerminal(width, height)
+		if err != nil {
+			return ascii.Options{}, fmt.Errorf("bounds error: %v", err)
+		}
+	}
+
+	return opts, nil
+}
+
+// frameDither returns the dithering of the frames of a video or animation, dither unless --dither was left out.
+// Ordered dithering gives the same pattern on every frame, error diffusion would make the frames shimmer.
+func frameDither(flags cmd.Command, dither generator.DitherMode) generator.DitherMode {
+	if flags.Dither == "" {
+		return generator.DitherBayer4
+	}
+
+	return dither
+}
+
+// fitsOutput returns whether art of cols x rows characters is written to stdout. It always is when stdout is
+// not a terminal, as plain text for pipes and files. In a terminal it has to fit on the screen.
+func fitsOutput(cols, rows int) (bool, error) {
+	if !utils.IsTerminal() {
+		return true, nil
+	}
+
+	termW, termH, err := utils.GetTerminalSize()
+	if err != nil {
+		return false, fmt.Errorf("terminal size error: %v", err)
+	}
+
+	return cols <= termW && rows <= termH, nil
+}
@@ -0,0 +1,142 @@
+package convertor
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/JoelVCrasta/goskii/ascii"
+	"github.com/JoelVCrasta/goskii/cmd"
+	"github.com/JoelVCrasta/goskii/generator"
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// outputColors returns the default text and background colors for rendered output.
+func outputColors(flags cmd.Command) (color.RGBA, color.RGBA, error) {
+	fg, err := generator.ParseHexColor(flags.Foreground)
+	if err != nil {
+		return fg, fg, fmt.Errorf("invalid foreground color \"%s\"", flags.Foreground)
+	}
+
+	bg, err := generator.ParseHexColor(flags.Background)
+	if err != nil {
+		return fg, bg, fmt.Errorf("invalid background color \"%s\"", flags.Background)
+	}
+
+	return fg, bg, nil
+}
+
+// charsetName returns how the charset of opts is recorded in goskii files: the quoted --chars ramp, the name of
+// a charset file, or the number of a built-in charset. Numbers of charset files depend on the files present.
+func charsetName(opts ascii.Options) string {
+	if opts.Chars != "" {
+		return strconv.Quote(opts.Chars)
+	}
+
+	number := max(opts.Charset, 1)
+	for _, custom := range generator.GetCustomCharsets() {
+		if custom.Number == number {
+			return custom.Name
+		}
+	}
+
+	return strconv.Itoa(number)
+}
+
+// artHeader returns the metadata of goskii files saved from art converted with opts.
+func artHeader(opts ascii.Options, source string, fps float64) utils.ArtHeader {
+	return utils.ArtHeader{
+		Fps:     fps,
+		Charset: charsetName(opts),
+		Color:   opts.ColorMode().String(),
+		Mode:    opts.Mode.String(),
+		Source:  source,
+	}
+}
+
+// saveImageOutput saves the ASCII art of an image to the -o path. Paths ending in .png are rendered to a
+// PNG image. Any other path is a goskii file of a single frame, or a folder the goskii file is written to,
+// named after the source, like the frames of a video.
+func saveImageOutput(art string, flags cmd.Command, header utils.ArtHeader) error {
+	switch strings.ToLower(filepath.Ext(flags.Output)) {
+	case ".png":
+	case utils.ArtFileExt:
+		return saveArtFrame(art, flags.Output, header)
+	default:
+		return saveArtFrame(art, filepath.Join(flags.Output, header.Source+utils.ArtFileExt), header)
+	}
+
+	fg, bg, err := outputColors(flags)
+	if err != nil {
+		return err
+	}
+
+	face, err := generator.LoadFace(flags.Font, float64(flags.FontSize))
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	return utils.SaveToPNG(generator.RasterizeArt(art, face, fg, bg), flags.Output)
+}
+
+// saveArtFrame saves the art of an image as a goskii file of a single frame.
+func saveArtFrame(art, path string, header utils.ArtHeader) error {
+	frames := make(chan utils.Frame, 1)
+	frames <- utils.Frame{ASCII: art}
+	close(frames)
+
+	return utils.SaveFramesToArtFile(frames, path, header)
+}
+
+/*
+	saveVideoOutput saves the ASCII frames of a video or animation to the -o path as they arrive. Paths ending
+	in .gif, .mp4 or .webm are rendered to an animation that keeps the timing of the frames, .mp4 and .webm at
+	header.Fps and with the audio of audioSource if it is set. Any other path is a goskii file, or a folder the
+	goskii file is written to, named after the source. The frames channel is always drained, even on error.
+*/
+func saveVideoOutput(asciiFrames <-chan utils.Frame, flags cmd.Command, header utils.ArtHeader, audioSource string) error {
+	defer func() {
+		for range asciiFrames {
+		}
+	}()
+
+	ext := strings.ToLower(filepath.Ext(flags.Output))
+	switch ext {
+	case ".gif", ".mp4", ".webm":
+	case utils.ArtFileExt:
+		return utils.SaveFramesToArtFile(asciiFrames, flags.Output, header)
+	default:
+		return utils.SaveFramesToArtFile(asciiFrames, filepath.Join(flags.Output, header.Source+utils.ArtFileExt), header)
+	}
+
+	fg, bg, err := outputColors(flags)
+	if err != nil {
+		return err
+	}
+
+	face, err := generator.LoadFace(flags.Font, float64(flags.FontSize))
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	frames := make(chan utils.ImageFrame, 4)
+	go func() {
+		defer close(frames)
+		for frame := range asciiFrames {
+			frames <- utils.ImageFrame{
+				Image:    generator.RasterizeArt(strings.Trim(frame.ASCII, "\n"), face, fg, bg),
+				Duration: frame.Duration,
+			}
+		}
+	}()
+
+	if ext == ".gif" {
+		return utils.SaveToGIF(frames, flags.Output, fg, bg)
+	}
+
+	return utils.SaveToVideo(frames, flags.Output, header.Fps, audioSource)
+}
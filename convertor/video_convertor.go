@@ -1,158 +1,190 @@
 package convertor
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"io"
+	"os"
+	"path/filepath"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/JoelVCrasta/goskii/ascii"
 	"github.com/JoelVCrasta/goskii/cmd"
-	"github.com/JoelVCrasta/goskii/generator"
 	"github.com/JoelVCrasta/goskii/utils"
 )
 
-// processFrames processes a batch of frames concurrently and appends the ASCII representation to the builder.
-func processFrames(frames []image.Image, builder *strings.Builder, charset, width, height int, frameCount *int32) {
-	var (
-		wg 			sync.WaitGroup
-		asciiFrames = make([]string, len(frames))	
-	)
-
-	for idx, frame := range frames {
-		wg.Add(1)
-		go func(i int, f image.Image) {
-			defer wg.Done()
-
-			grayFrame := utils.Grayscale(f)
-			resizedFrame := utils.ResizeGray(grayFrame, width, height)
-			asciiFrames[i] = generator.GenerateASCII(resizedFrame, width, height, charset-1)
-
-			atomic.AddInt32(frameCount, 1)
-		}(idx, frame)
-	}
-
-	wg.Wait()
+// splitErr forwards the frames of a stream without the error frame it may end with, which is sent to the
+// second channel once the first one is closed.
+func splitErr(frames <-chan ascii.Frame) (<-chan utils.Frame, <-chan error) {
+	out, errc := make(chan utils.Frame, 1), make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+		var err error
+		for frame := range frames {
+			if frame.Err != nil {
+				err = frame.Err
+				continue
+			}
+			out <- frame
+		}
+		errc <- err
+	}()
 
-	for _, asciiFrame := range asciiFrames {
-		builder.WriteString(asciiFrame)
-		builder.WriteString("\n\n")
-	}
+	return out, errc
 }
 
-/* 
-	decodeAndProcessStream extracts frames from an MJPEG stream, converts them to ASCII, and returns the final ASCII representation.
-
-	1) Read the stream from io.PipeReader in chunks and accumulate data in a buffer.
+// teeFrames copies every frame to two channels, for playing and saving a video at the same time.
+func teeFrames(frames <-chan utils.Frame) (<-chan utils.Frame, <-chan utils.Frame) {
+	first, second := make(chan utils.Frame, 1), make(chan utils.Frame, 1)
 
-	2) Detect JPEG frames using SOI (0xFFD8) and EOI (0xFFD9) markers.
+	go func() {
+		defer close(first)
+		defer close(second)
+		for frame := range frames {
+			first <- frame
+			second <- frame
+		}
+	}()
 
-	3) Decode and append frames to the frames slice and process them in batches of 12.
+	return first, second
+}
 
-	4) If slice length is 12, process the frames concurrently and reset the slice.
+/*
+	playAndSave starts the conversion with convert, plays the converted frames in the terminal if shouldPrint is
+	set and saves them with save if an output path is set, then returns the error of the conversion, if any. total
+	is the duration of the stream shown by the player, 0 if it is unknown.
 
-	5) Process the remaining frames and return the final ASCII representation.
+	When ctx is cancelled, or playback is stopped with Ctrl-C, the conversion stops and the frames converted so far
+	are still saved, so the output is complete up to that point. The cause of the stop is returned. q only stops
+	the conversion when nothing is saved, otherwise it stops playback and the conversion goes on to the end of
+	the output.
 */
-func decodeAndProcessStream(videoData *utils.VideoData, charset, width, height int) (string, error) {
-	const (
-		batchSize = 16
-		bufferSize = 1024
-	)
-
-	var (
-		frames 		= make([]image.Image, 0, batchSize) // Slice to store 16 frames
-		builder	 	strings.Builder
-		frameCount 	int32
-		frameBuffer bytes.Buffer
-		buf 		= make([]byte, bufferSize)
-	)
-
-	for {
-		n, err := videoData.Reader.Read(buf)
-		if n > 0 {
-			frameBuffer.Write(buf[:n])
-
-			data := frameBuffer.Bytes()
-			startIdx := bytes.Index(data, []byte{0xFF, 0xD8}) // SOI marker
-			endIdx := bytes.Index(data, []byte{0xFF, 0xD9})   // EOI marker
-
-			if startIdx != -1 && endIdx != -1 && endIdx > startIdx {
-				jpegData := data[startIdx : endIdx+2]
-
-				// Decode the JPEG frame and append it to the frames slice
-				frame, err := jpeg.Decode(bytes.NewReader(jpegData))
-				if err != nil {
-					return "", fmt.Errorf("failed to decode JPEG frame: %w", err)
-				}
-				frames = append(frames, frame)
-
-				// Remove processed frame data from the buffer and keep the unprocessed data
-				frameBuffer.Next(endIdx + 2)
-			}
-		}
-
-		if err == io.EOF {
-			break
+func playAndSave(
+	ctx context.Context,
+	convert func(context.Context) (<-chan ascii.Frame, error),
+	total time.Duration,
+	flags cmd.Command,
+	shouldPrint bool,
+	save func(<-chan utils.Frame) error,
+) error {
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	stream, err := convert(ctx)
+	if err != nil {
+		return err
+	}
+	frames, errc := splitErr(stream)
+
+	// A player stopped by a key leaves the rest of the frames, they end once the conversion is stopped or is over
+	play := func(frames <-chan utils.Frame, saving bool) {
+		err := utils.PlayVideo(ctx, frames, total)
+		switch {
+		case saving && errors.Is(err, utils.ErrQuit):
+			fmt.Fprintf(os.Stderr, "Playback stopped, still saving to %s. Press Ctrl-C to stop.\n", flags.Output)
+		case err != nil:
+			stop(err)
 		}
-		if err != nil {
-			return "", fmt.Errorf("error reading MJPEG stream: %w", err)
+		for range frames {
 		}
+	}
+
+	var saveErr error
+	switch {
+	case shouldPrint && flags.Output != "":
+		playFrames, saveFrames := teeFrames(frames)
+		saved := make(chan error, 1)
+		go func() {
+			saved <- save(saveFrames)
+		}()
+
+		play(playFrames, true)
+		saveErr = <-saved
+	case shouldPrint:
+		play(frames, false)
+	default:
+		saveErr = save(frames)
+	}
 
-		if len(frames) == batchSize {
-			processFrames(frames, &builder, charset, width, height, &frameCount)
-			frames = frames[:0]
+	if ctx.Err() != nil {
+		if flags.Output != "" {
+			if saveErr != nil {
+				fmt.Fprintf(os.Stderr, "Stopped, %s may be incomplete: %v\n", flags.Output, saveErr)
+			} else {
+				fmt.Fprintf(os.Stderr, "Stopped, the frames converted so far were saved to %s.\n", flags.Output)
+			}
 		}
+		return context.Cause(ctx)
 	}
 
-	if len(frames) > 0 {
-		processFrames(frames, &builder, charset, width, height, &frameCount)
+	if saveErr != nil {
+		return fmt.Errorf("error saving to file: %v", saveErr)
 	}
 
-	return builder.String(), nil
-}
+	if err := <-errc; err != nil {
+		return fmt.Errorf("error processing stream: %v", err)
+	}
 
+	return nil
+}
 
 // VideoToASCII converts a video to ASCII art.
-func VideoToASCII(flags cmd.Command) error {
-	videoData, err := utils.LoadVideo(flags.Path)
+func VideoToASCII(ctx context.Context, flags cmd.Command) error {
+	video, err := ascii.OpenVideo(ctx, flags.Path)
 	if err != nil {
 		return fmt.Errorf("load error: %v", err)
 	}
-	defer videoData.Reader.Close()
 
-	width, height, err := utils.CalculateNewBounds(videoData.Width, videoData.Height, flags.Size)
-	if  err != nil {
-		return fmt.Errorf("bounds error: %v", err)
+	opts, err := newOptions(flags, video.Width, video.Height)
+	if err != nil {
+		return err
 	}
 
-	termW, termH, err := utils.GetTerminalSize()
+	opts.Dither = frameDither(flags, opts.Dither)
+
+	cols, rows := ascii.GridSize(video.Width, video.Height, opts)
+	shouldPrint, err := fitsOutput(cols, rows)
 	if err != nil {
-		return fmt.Errorf("terminal size error: %v", err)
+		return err
 	}
-
-	shouldPrint := width <= termW && height <= termH
 	if !shouldPrint && flags.Output == "" {
 		fmt.Println("ASCII art is too large to fit in the terminal. Increase the terminal size or use the -o flag to save to a file.")
 	}
 
-	ascii, err := decodeAndProcessStream(videoData, flags.Charset, width, height)
-	if err != nil {
-		return fmt.Errorf("error processing stream: %v", err)
+	if strings.EqualFold(filepath.Ext(flags.Output), ".png") {
+		return fmt.Errorf("save error: PNG output is only supported for images")
 	}
 
-	if shouldPrint && ascii != "" {
-		utils.RenderVideo(ascii, flags.Fps)
+	if !shouldPrint && flags.Output == "" {
+		return nil
 	}
 
-	if flags.Output != "" {
-		err := utils.SaveToTextFile(ascii, flags.Output, videoData.FileName)
-		if err != nil {
-			return fmt.Errorf("error saving to file: %v", err)
+	audioSource := ""
+	if flags.Audio {
+		switch {
+		case video.Path == utils.StdinPath:
+			fmt.Fprintln(os.Stderr, "The audio of a video read from stdin can't be saved, saving without it.")
+		case video.HasAudio:
+			audioSource = video.Path
+		default:
+			fmt.Fprintln(os.Stderr, "The source video has no audio, saving without it.")
 		}
 	}
 
-	return nil
+	// Exports are encoded at the rate the frames are extracted at
+	fps := opts.FrameRate
+	if fps <= 0 {
+		fps = video.FrameRate
+	}
+
+	convert := func(ctx context.Context) (<-chan ascii.Frame, error) {
+		return video.Frames(ctx, opts)
+	}
+
+	return playAndSave(ctx, convert, video.Duration, flags, shouldPrint, func(frames <-chan utils.Frame) error {
+		return saveVideoOutput(frames, flags, artHeader(opts, video.Name, fps), audioSource)
+	})
 }
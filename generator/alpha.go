@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AlphaMode decides how the transparent pixels of sources with an alpha channel are drawn.
+type AlphaMode int
+
+const (
+	AlphaBlank      AlphaMode = iota // Cells that are fully transparent are left blank
+	AlphaThreshold                   // Cells less opaque than a threshold are left blank
+	AlphaBackground                  // Transparent pixels are composited over a background color, no cell is blank
+)
+
+// ParseAlphaMode converts the value of the --alpha flag to an AlphaMode.
+func ParseAlphaMode(mode string) (AlphaMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "blank":
+		return AlphaBlank, nil
+	case "threshold":
+		return AlphaThreshold, nil
+	case "background", "bg":
+		return AlphaBackground, nil
+	default:
+		return AlphaBlank, fmt.Errorf("unknown alpha mode \"%s\"", mode)
+	}
+}
+
+// String returns the name of the alpha mode, as accepted by ParseAlphaMode.
+func (mode AlphaMode) String() string {
+	switch mode {
+	case AlphaThreshold:
+		return "threshold"
+	case AlphaBackground:
+		return "background"
+	default:
+		return "blank"
+	}
+}
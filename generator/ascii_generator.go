@@ -1,11 +1,16 @@
 package generator
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"strings"
+	"sync"
 )
 
+// Guards charsets, customCharsets and the calibrated levels, which charset files and calibrations add to.
+var charsetsMutex sync.RWMutex
+
 var charsets = [][]string{
 	// ASCII 1 lightest to darkest
     {".", ":", "-", "+", "*", "?", "#", "%", "$", "@"},
@@ -48,19 +53,64 @@ var charsets = [][]string{
 }
 
 
-func getASCIIChar(c color.Gray, charset int) string {
-	gray := c.Y
-	normalized := int(float64(gray) / 255.0 * float64(len(charsets[charset]) - 1))
+/*
+	Charset is a ramp of glyphs from the least to the most ink, with the measured brightness of the glyphs if it
+	has been calibrated. It never changes once made, so every conversion takes its own and reads it without
+	locking, also while charsets are being added.
+*/
+type Charset struct {
+	glyphs []string
+	levels []float64 // Measured brightness (0 - 1) of every glyph, nil if not calibrated
+	lookup *[256]int // Glyph index for every gray value, built from levels so lookups stay cheap
+}
+
+// NewCharset makes a charset of glyphs that isn't registered, for a ramp used by one conversion.
+func NewCharset(glyphs []string) (*Charset, error) {
+	if len(glyphs) < 2 {
+		return nil, fmt.Errorf("a charset needs at least 2 characters")
+	}
 
-	return charsets[charset][normalized]
+	return &Charset{glyphs: glyphs}, nil
 }
 
+// GetCharset returns the charset with the given number, starting at 1.
+func GetCharset(number int) (*Charset, error) {
+	charsetsMutex.RLock()
+	defer charsetsMutex.RUnlock()
+
+	index := number - 1
+	if index < 0 || index >= len(charsets) {
+		return nil, fmt.Errorf("no charset %d", number)
+	}
+
+	return &Charset{
+		glyphs: charsets[index],
+		levels: charsetLevels[index],
+		lookup: levelLookup[index],
+	}, nil
+}
+
+func getASCIIChar(c color.Gray, charset *Charset) string {
+	if charset.lookup != nil {
+		return charset.glyphs[charset.lookup[c.Y]]
+	}
+
+	gray := int(c.Y)
+	normalized := gray * (len(charset.glyphs) - 1) / 255
+
+	return charset.glyphs[normalized]
+}
+
+// GetCharsets returns the glyphs of every charset, indexed by number - 1.
 func GetCharsets () [][]string {
-	return charsets
+	charsetsMutex.RLock()
+	defer charsetsMutex.RUnlock()
+
+	return append([][]string(nil), charsets...)
 }
 
 // Generates ASCII art from a grayscale image.
-func GenerateASCII(img *image.Gray, width, height int, charset int) string {
+func GenerateASCII(img *image.Gray, width, height int, charset *Charset) string {
 	var builder strings.Builder
 
 	for y := 0; y < height; y++ {
@@ -75,7 +125,7 @@ func GenerateASCII(img *image.Gray, width, height int, charset int) string {
 }
 
 // Generates ASCII art from a grayscale image with alpha channel.
-func GenerateASCIIAlpha(img *image.Gray, alpha [][]uint8, width, height int, charset int) string {
+func GenerateASCIIAlpha(img *image.Gray, alpha [][]uint8, width, height int, charset *Charset) string {
 	var builder strings.Builder
 
 	for y := 0; y < height; y++ {
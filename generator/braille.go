@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"image"
+	"image/color"
+	"strings"
+)
+
+const brailleBase = 0x2800
+
+// Bit of the braille pattern for each pixel of a 2x4 block, indexed by [y][x].
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// averageBlock returns the average color of the w x h block at (x0, y0).
+func averageBlock(colors *image.RGBA, x0, y0, w, h int) color.RGBA {
+	var r, g, b, a int
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			c := colors.RGBAAt(x, y)
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			a += int(c.A)
+		}
+	}
+	n := w * h
+
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+}
+
+/*
+	Generates braille art from a grayscale image. Every 2x4 block of pixels becomes one U+2800 character,
+	with a dot raised for each pixel that is at least as bright as the threshold. width and height are the
+	size of the pixel grid, so the output has width/2 columns and height/4 rows.
+
+	If a color mode is set, each character is colored with the average color of its block.
+*/
+func GenerateBraille(img *image.Gray, colors *image.RGBA, width, height int, threshold uint8, mode ColorMode) string {
+	var builder strings.Builder
+	cols, rows := width/2, height/4
+
+	for row := 0; row < rows; row++ {
+		current := ""
+		for col := 0; col < cols; col++ {
+			x0, y0 := col*2, row*4
+
+			pattern := rune(0)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if img.GrayAt(x0+dx, y0+dy).Y >= threshold {
+						pattern |= brailleDots[dy][dx]
+					}
+				}
+			}
+
+			if mode != ColorNone && pattern != 0 {
+				writeColor(&builder, averageBlock(colors, x0, y0, 2, 4), mode, &current)
+			}
+			builder.WriteRune(brailleBase + pattern)
+		}
+		if mode != ColorNone {
+			builder.WriteString(sgrReset)
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
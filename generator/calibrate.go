@@ -0,0 +1,132 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	// Measured brightness (0 - 1) of every glyph, for charsets that have been calibrated. Indexed like charsets.
+	charsetLevels = map[int][]float64{}
+
+	// Glyph index for every gray value, built from charsetLevels so lookups stay cheap.
+	levelLookup = map[int]*[256]int{}
+)
+
+// SetCharsetLevels makes the charset with the given number map luminance to glyphs by measured brightness
+// instead of by position. levels holds one value (0 - 1) per glyph and must be in ascending order.
+func SetCharsetLevels(number int, levels []float64) error {
+	charsetsMutex.Lock()
+	defer charsetsMutex.Unlock()
+
+	index := number - 1
+	if index < 0 || index >= len(charsets) {
+		return fmt.Errorf("charset %d does not exist", number)
+	}
+	if len(levels) != len(charsets[index]) {
+		return fmt.Errorf("charset %d has %d characters but %d densities", number, len(charsets[index]), len(levels))
+	}
+	for i := 1; i < len(levels); i++ {
+		if levels[i] < levels[i-1] {
+			return fmt.Errorf("densities of charset %d are not in ascending order", number)
+		}
+	}
+
+	var lookup [256]int
+	for gray := range lookup {
+		lookup[gray] = nearestLevel(float64(gray)/255, levels)
+	}
+
+	charsetLevels[index] = levels
+	levelLookup[index] = &lookup
+
+	return nil
+}
+
+// Calibration is the result of measuring the ink coverage of a charset with a font.
+type Calibration struct {
+	Glyphs    []string  // from the least to the most ink
+	Densities []float64 // coverage of each glyph, scaled so the lightest is 0 and the darkest is 1
+	Missing   []string  // glyphs the font has no shape for, left out of Glyphs
+}
+
+/*
+	Calibrate rasterizes every glyph with the face, measures how much of the cell it covers and sorts the
+	glyphs by that coverage. Duplicate glyphs are dropped.
+
+	If levels is set and smaller than the number of glyphs, only that many glyphs are kept, picked so their
+	densities are as close as possible to evenly spaced steps between the lightest and the darkest glyph.
+*/
+func Calibrate(face *GlyphFace, glyphs []string, levels int) (Calibration, error) {
+	var result Calibration
+	type measured struct {
+		glyph    string
+		coverage float64
+	}
+
+	seen := map[string]bool{}
+	var measures []measured
+	for _, glyph := range glyphs {
+		if seen[glyph] {
+			continue
+		}
+		seen[glyph] = true
+
+		mask, ok := RasterizeGlyph(face, glyph)
+		if !ok {
+			result.Missing = append(result.Missing, glyph)
+			continue
+		}
+		measures = append(measures, measured{glyph, coverage(mask)})
+	}
+
+	if len(measures) < 2 {
+		return result, fmt.Errorf("the font can draw fewer than 2 of the characters")
+	}
+
+	sort.SliceStable(measures, func(i, j int) bool {
+		return measures[i].coverage < measures[j].coverage
+	})
+
+	lightest, darkest := measures[0].coverage, measures[len(measures)-1].coverage
+	if darkest == lightest {
+		return result, fmt.Errorf("all characters have the same density")
+	}
+
+	densities := make([]float64, len(measures))
+	for i, m := range measures {
+		densities[i] = (m.coverage - lightest) / (darkest - lightest)
+	}
+
+	picked := make([]int, 0, len(measures))
+	if levels >= 2 && levels < len(measures) {
+		// Walk the evenly spaced targets and take the closest glyph that comes after the last one picked
+		next := 0
+		for k := 0; k < levels; k++ {
+			target := float64(k) / float64(levels-1)
+			remaining := levels - k
+			last := len(measures) - remaining
+
+			best := next
+			for i := next; i <= last; i++ {
+				if math.Abs(densities[i]-target) < math.Abs(densities[best]-target) {
+					best = i
+				}
+			}
+			picked = append(picked, best)
+			next = best + 1
+		}
+	} else {
+		for i := range measures {
+			picked = append(picked, i)
+		}
+	}
+
+	for _, i := range picked {
+		result.Glyphs = append(result.Glyphs, measures[i].glyph)
+		result.Densities = append(result.Densities, densities[i])
+	}
+
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+type ColorMode int
+
+const (
+	ColorNone ColorMode = iota
+	Color16
+	Color256
+	ColorTrue
+)
+
+const sgrReset = "\033[0m"
+
+// Standard xterm values of the 16 ANSI colors, in SGR order (30-37, then 90-97).
+var ansi16Palette = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// Channel levels of the 6x6x6 color cube in the 256 color palette.
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// ParseColorMode converts the value of the --color flag to a ColorMode.
+func ParseColorMode(mode string) (ColorMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "none":
+		return ColorNone, nil
+	case "16":
+		return Color16, nil
+	case "256":
+		return Color256, nil
+	case "true", "truecolor", "24bit":
+		return ColorTrue, nil
+	default:
+		return ColorNone, fmt.Errorf("unknown color mode \"%s\"", mode)
+	}
+}
+
+// String returns the name of the color mode, as accepted by ParseColorMode.
+func (mode ColorMode) String() string {
+	switch mode {
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case ColorTrue:
+		return "truecolor"
+	default:
+		return "none"
+	}
+}
+
+// ParseHexColor parses a color written as "#rrggbb" or "rrggbb".
+func ParseHexColor(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, strconv.ErrSyntax
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, strconv.ErrSyntax
+	}
+
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, nil
+}
+
+func colorDistance(r1, g1, b1, r2, g2, b2 uint8) int {
+	dr := int(r1) - int(r2)
+	dg := int(g1) - int(g2)
+	db := int(b1) - int(b2)
+
+	return dr*dr + dg*dg + db*db
+}
+
+// nearest16 returns the index (0-15) of the closest ANSI color.
+func nearest16(r, g, b uint8) int {
+	best, bestDist := 0, -1
+	for i, p := range ansi16Palette {
+		d := colorDistance(r, g, b, p[0], p[1], p[2])
+		if bestDist == -1 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+
+	return best
+}
+
+func nearestCubeLevel(v uint8) int {
+	best, bestDist := 0, 256
+	for i, l := range cubeLevels {
+		d := int(v) - int(l)
+		if d < 0 {
+			d = -d
+		}
+		if d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+
+	return best
+}
+
+// nearest256 returns the closest entry of the 256 color palette, choosing between the color cube and the gray ramp.
+func nearest256(r, g, b uint8) int {
+	ri, gi, bi := nearestCubeLevel(r), nearestCubeLevel(g), nearestCubeLevel(b)
+	cubeIdx := 16 + 36*ri + 6*gi + bi
+	cubeDist := colorDistance(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	avg := (int(r) + int(g) + int(b)) / 3
+	grayStep := (avg - 3) / 10
+	if grayStep < 0 {
+		grayStep = 0
+	} else if grayStep > 23 {
+		grayStep = 23
+	}
+	grayLevel := uint8(8 + 10*grayStep)
+	grayDist := colorDistance(r, g, b, grayLevel, grayLevel, grayLevel)
+
+	if grayDist < cubeDist {
+		return 232 + grayStep
+	}
+	return cubeIdx
+}
+
+// sgrParams returns the SGR parameters selecting c as the foreground (or background) color in the given mode.
+func sgrParams(c color.RGBA, mode ColorMode, background bool) string {
+	switch mode {
+	case Color16:
+		idx := nearest16(c.R, c.G, c.B)
+		base := 30
+		if idx >= 8 {
+			base, idx = 90, idx-8
+		}
+		if background {
+			base += 10
+		}
+		return fmt.Sprintf("%d", base+idx)
+	case Color256:
+		if background {
+			return fmt.Sprintf("48;5;%d", nearest256(c.R, c.G, c.B))
+		}
+		return fmt.Sprintf("38;5;%d", nearest256(c.R, c.G, c.B))
+	case ColorTrue:
+		if background {
+			return fmt.Sprintf("48;2;%d;%d;%d", c.R, c.G, c.B)
+		}
+		return fmt.Sprintf("38;2;%d;%d;%d", c.R, c.G, c.B)
+	default:
+		return ""
+	}
+}
+
+// writeColor writes the foreground escape sequence for c, unless it is the same as the one written last.
+func writeColor(builder *strings.Builder, c color.RGBA, mode ColorMode, current *string) {
+	params := sgrParams(c, mode, false)
+	if params != *current {
+		builder.WriteString("\033[" + params + "m")
+		*current = params
+	}
+}
+
+// Generates colored ASCII art. The glyph of every cell is picked from the grayscale image and its
+// foreground color from the resized color image. An escape sequence is only written when the color
+// differs from the previous cell, and every line ends with a reset. Cells with zero alpha are left blank.
+func GenerateASCIIColor(img *image.Gray, colors *image.RGBA, alpha [][]uint8, width, height int, charset *Charset, mode ColorMode) string {
+	var builder strings.Builder
+
+	for y := 0; y < height; y++ {
+		current := ""
+		for x := 0; x < width; x++ {
+			if alpha != nil && alpha[y][x] == 0 {
+				builder.WriteString(" ")
+				continue
+			}
+
+			writeColor(&builder, colors.RGBAAt(x, y), mode, &current)
+			builder.WriteString(getASCIIChar(img.GrayAt(x, y), charset))
+		}
+		builder.WriteString(sgrReset)
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const CharsetFileExt = ".charset"
+
+// CustomCharset describes a charset added at runtime, from --chars or a charset file.
+type CustomCharset struct {
+	Number      int // position in the charsets slice, starting at 1 like the built-in sets
+	Name        string
+	Description string
+}
+
+var customCharsets []CustomCharset
+
+// GetCustomCharsets returns the charsets added with AddCharset, in the order they were added.
+func GetCustomCharsets() []CustomCharset {
+	charsetsMutex.RLock()
+	defer charsetsMutex.RUnlock()
+
+	return append([]CustomCharset(nil), customCharsets...)
+}
+
+// AddCharset appends a charset after the built-in ones and returns its number.
+func AddCharset(name, description string, glyphs []string) (int, error) {
+	if len(glyphs) < 2 {
+		return 0, fmt.Errorf("charset \"%s\" needs at least 2 characters", name)
+	}
+	// --charset takes numbers as the built-in charsets, a name that is a number would hide one
+	if _, err := strconv.Atoi(name); err == nil {
+		return 0, fmt.Errorf("charset name \"%s\" is a number, which --charset reads as a charset number", name)
+	}
+
+	charsetsMutex.Lock()
+	defer charsetsMutex.Unlock()
+
+	if _, exists := findCharset(name); exists {
+		return 0, fmt.Errorf("charset \"%s\" is already defined", name)
+	}
+
+	charsets = append(charsets, glyphs)
+	number := len(charsets)
+	customCharsets = append(customCharsets, CustomCharset{
+		Number:      number,
+		Name:        name,
+		Description: description,
+	})
+
+	return number, nil
+}
+
+// FindCharset returns the number of the custom charset with the given name (case insensitive).
+func FindCharset(name string) (int, bool) {
+	charsetsMutex.RLock()
+	defer charsetsMutex.RUnlock()
+
+	return findCharset(name)
+}
+
+func findCharset(name string) (int, bool) {
+	for _, set := range customCharsets {
+		if strings.EqualFold(set.Name, name) {
+			return set.Number, true
+		}
+	}
+	return 0, false
+}
+
+// SplitGlyphs splits a ramp into its characters.
+func SplitGlyphs(ramp string) []string {
+	glyphs := make([]string, 0, len(ramp))
+	for _, r := range ramp {
+		glyphs = append(glyphs, string(r))
+	}
+	return glyphs
+}
+
+/*
+	parseCharsetFile reads a charset file made of "key: value" lines. Empty lines and lines starting with # are ignored.
+
+		name: dots
+		description: Dots from small to large.
+		ramp: " .·•●"
+		direction: light-to-dark
+		densities: 0 0.12 0.31 0.66 1
+
+	The ramp is always written from the least to the most ink. Quote it when it starts or ends with a space.
+	direction is light-to-dark (the default, for dark terminals) or dark-to-light, which reverses the ramp.
+	densities is optional and holds the measured ink (0 - 1) of each glyph in ramp order, see goskii calibrate.
+*/
+func parseCharsetFile(path string) (name, description string, glyphs []string, levels []float64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+	defer file.Close()
+
+	var ramp, direction string
+	var densities []float64
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(text, ":")
+		if !found {
+			return "", "", nil, nil, fmt.Errorf("line %d: expected \"key: value\"", line)
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "name":
+			name = value
+		case "description":
+			description = value
+		case "ramp":
+			if strings.HasPrefix(value, "\"") {
+				if value, err = strconv.Unquote(value); err != nil {
+					return "", "", nil, nil, fmt.Errorf("line %d: invalid quoted ramp", line)
+				}
+			}
+			ramp = value
+		case "direction":
+			direction = strings.ToLower(value)
+		case "densities":
+			for _, field := range strings.Fields(value) {
+				density, err := strconv.ParseFloat(field, 64)
+				if err != nil || density < 0 || density > 1 {
+					return "", "", nil, nil, fmt.Errorf("line %d: densities should be numbers between 0 and 1", line)
+				}
+				densities = append(densities, density)
+			}
+		default:
+			return "", "", nil, nil, fmt.Errorf("line %d: unknown key \"%s\"", line, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", nil, nil, err
+	}
+
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), CharsetFileExt)
+	}
+	if ramp == "" {
+		return "", "", nil, nil, fmt.Errorf("missing ramp")
+	}
+
+	glyphs = SplitGlyphs(ramp)
+	if densities != nil && len(densities) != len(glyphs) {
+		return "", "", nil, nil, fmt.Errorf("the ramp has %d characters but %d densities", len(glyphs), len(densities))
+	}
+
+	switch direction {
+	case "", "light-to-dark":
+		levels = densities
+	case "dark-to-light":
+		// The most ink now stands for the darkest pixels, so the brightness of each glyph is the inverse of its ink
+		for i, j := 0, len(glyphs)-1; i < j; i, j = i+1, j-1 {
+			glyphs[i], glyphs[j] = glyphs[j], glyphs[i]
+		}
+		for i := len(densities) - 1; i >= 0; i-- {
+			levels = append(levels, 1-densities[i])
+		}
+	default:
+		return "", "", nil, nil, fmt.Errorf("direction should be light-to-dark or dark-to-light")
+	}
+
+	return name, description, glyphs, levels, nil
+}
+
+// CharsetDir returns the folder user charset files are loaded from, $XDG_CONFIG_HOME/goskii/charsets or ~/.config/goskii/charsets.
+func CharsetDir() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "goskii", "charsets"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "goskii", "charsets"), nil
+}
+
+// LoadCharsetDir adds every charset file in dir, sorted by file name. A missing folder is not an error.
+// Files that fail to parse are skipped and reported together in the returned error.
+func LoadCharsetDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+CharsetFileExt))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, path := range paths {
+		name, description, glyphs, levels, err := parseCharsetFile(path)
+		if err == nil {
+			var number int
+			number, err = AddCharset(name, description, glyphs)
+			if err == nil && levels != nil {
+				err = SetCharsetLevels(number, levels)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", filepath.Base(path), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
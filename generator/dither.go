@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+type DitherMode int
+
+const (
+	DitherNone DitherMode = iota
+	DitherFloydSteinberg
+	DitherAtkinson
+	DitherJarvisJudiceNinke
+	DitherBayer2
+	DitherBayer4
+	DitherBayer8
+)
+
+// diffusion is one entry of an error diffusion kernel, relative to the current pixel.
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+var diffusionKernels = map[DitherMode][]diffusion{
+	DitherFloydSteinberg: {
+		{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	},
+	// Atkinson only spreads 6/8 of the error, which keeps highlights and shadows clean.
+	DitherAtkinson: {
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+		{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+		{0, 2, 1.0 / 8},
+	},
+	DitherJarvisJudiceNinke: {
+		{1, 0, 7.0 / 48}, {2, 0, 5.0 / 48},
+		{-2, 1, 3.0 / 48}, {-1, 1, 5.0 / 48}, {0, 1, 7.0 / 48}, {1, 1, 5.0 / 48}, {2, 1, 3.0 / 48},
+		{-2, 2, 1.0 / 48}, {-1, 2, 3.0 / 48}, {0, 2, 5.0 / 48}, {1, 2, 3.0 / 48}, {2, 2, 1.0 / 48},
+	},
+}
+
+var bayerSizes = map[DitherMode]int{
+	DitherBayer2: 2,
+	DitherBayer4: 4,
+	DitherBayer8: 8,
+}
+
+// ParseDitherMode converts the value of the --dither flag to a DitherMode.
+func ParseDitherMode(mode string) (DitherMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "none":
+		return DitherNone, nil
+	case "floyd-steinberg", "floydsteinberg", "fs":
+		return DitherFloydSteinberg, nil
+	case "atkinson":
+		return DitherAtkinson, nil
+	case "jarvis-judice-ninke", "jjn":
+		return DitherJarvisJudiceNinke, nil
+	case "bayer2":
+		return DitherBayer2, nil
+	case "bayer4", "ordered":
+		return DitherBayer4, nil
+	case "bayer8":
+		return DitherBayer8, nil
+	default:
+		return DitherNone, fmt.Errorf("unknown dither mode \"%s\"", mode)
+	}
+}
+
+// bayerMatrix builds the n x n ordered dithering index matrix (n must be a power of two).
+func bayerMatrix(n int) [][]int {
+	if n == 1 {
+		return [][]int{{0}}
+	}
+
+	half := bayerMatrix(n / 2)
+	matrix := make([][]int, n)
+	for y := range matrix {
+		matrix[y] = make([]int, n)
+	}
+
+	for y := 0; y < n/2; y++ {
+		for x := 0; x < n/2; x++ {
+			v := 4 * half[y][x]
+			matrix[y][x] = v
+			matrix[y][x+n/2] = v + 2
+			matrix[y+n/2][x] = v + 3
+			matrix[y+n/2][x+n/2] = v + 1
+		}
+	}
+
+	return matrix
+}
+
+// levelValue returns the gray value that getASCIIChar maps to the given level out of levels.
+func levelValue(level, levels int) uint8 {
+	return uint8((level*255 + levels - 2) / (levels - 1))
+}
+
+// nearestLevel returns the index of the level closest to value. levels must be sorted in ascending order.
+func nearestLevel(value float64, levels []float64) int {
+	best := 0
+	for i, l := range levels {
+		if math.Abs(value-l) < math.Abs(value-levels[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// orderedLevel picks between the two levels around value, taking the upper one when value is past the threshold (0 - 1) between them.
+func orderedLevel(value, threshold float64, levels []float64) int {
+	if value <= levels[0] {
+		return 0
+	}
+	for i := 1; i < len(levels); i++ {
+		if value < levels[i] {
+			if (value-levels[i-1])/(levels[i]-levels[i-1]) > threshold {
+				return i
+			}
+			return i - 1
+		}
+	}
+	return len(levels) - 1
+}
+
+/*
+	Dither quantizes a grayscale image to the given number of evenly spaced levels, e.g. 2 for braille.
+	Every pixel of the result is set to a value that getASCIIChar maps to exactly one glyph, so the
+	dithering pattern carries over to the characters.
+
+	Error diffusion modes push the quantization error onto the neighbouring pixels. Ordered (Bayer) modes add a
+	fixed threshold pattern instead, which looks the same from frame to frame and does not shimmer in video.
+*/
+func Dither(img *image.Gray, levels int, mode DitherMode) *image.Gray {
+	if mode == DitherNone || levels < 2 {
+		return img
+	}
+
+	ideal := make([]float64, levels)
+	output := make([]uint8, levels)
+	for i := range ideal {
+		ideal[i] = float64(i) * 255 / float64(levels-1)
+		output[i] = levelValue(i, levels)
+	}
+
+	return ditherLevels(img, ideal, output, mode)
+}
+
+// DitherCharset dithers a grayscale image to the levels of a charset. Charsets with measured densities are
+// quantized to those densities, others to one evenly spaced level per glyph.
+func DitherCharset(img *image.Gray, charset *Charset, mode DitherMode) *image.Gray {
+	levels := charset.levels
+	if mode == DitherNone || levels == nil {
+		return Dither(img, len(charset.glyphs), mode)
+	}
+
+	ideal := make([]float64, len(levels))
+	output := make([]uint8, len(levels))
+	for i, l := range levels {
+		output[i] = uint8(math.Round(l * 255))
+		ideal[i] = float64(output[i])
+	}
+
+	return ditherLevels(img, ideal, output, mode)
+}
+
+// ditherLevels quantizes every pixel to one of the ideal gray values (ascending) and writes the matching output value.
+func ditherLevels(img *image.Gray, ideal []float64, output []uint8, mode DitherMode) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dithered := image.NewGray(image.Rect(0, 0, width, height))
+
+	if size, ok := bayerSizes[mode]; ok {
+		matrix := bayerMatrix(size)
+		cells := float64(size * size)
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				threshold := (float64(matrix[y%size][x%size]) + 0.5) / cells
+				value := float64(img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+				dithered.Pix[y*dithered.Stride+x] = output[orderedLevel(value, threshold, ideal)]
+			}
+		}
+
+		return dithered
+	}
+
+	kernel := diffusionKernels[mode]
+	buffer := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			buffer[y*width+x] = float64(img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := buffer[y*width+x]
+			level := nearestLevel(value, ideal)
+			dithered.Pix[y*dithered.Stride+x] = output[level]
+
+			quantError := value - ideal[level]
+			for _, d := range kernel {
+				nx, ny := x+d.dx, y+d.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				buffer[ny*width+nx] += quantError * d.weight
+			}
+		}
+	}
+
+	return dithered
+}
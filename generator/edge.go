@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"image"
+	"math"
+	"strings"
+
+	"github.com/JoelVCrasta/goskii/utils"
+)
+
+// edgeGlyph returns the character that follows the direction of an edge with gradient (gx, gy).
+// Horizontal edges in the lower half of the cell use an underscore instead of a dash.
+func edgeGlyph(gx, gy float64, lower bool) string {
+	// The edge runs perpendicular to the gradient. Image rows grow downwards, so flip y to get the screen angle.
+	angle := math.Atan2(-gx, -gy) * 180 / math.Pi
+	if angle < 0 {
+		angle += 180
+	}
+	if angle >= 180 {
+		angle -= 180
+	}
+
+	switch {
+	case angle < 22.5 || angle >= 157.5:
+		if lower {
+			return "_"
+		}
+		return "-"
+	case angle < 67.5:
+		return "/"
+	case angle < 112.5:
+		return "|"
+	default:
+		return "\\"
+	}
+}
+
+/*
+	Generates ASCII art that outlines edges. Cells whose edge magnitude reaches the threshold are drawn with
+	a direction-matched character (| / - \ _), all other cells are filled from the charset by luminance.
+	The edge map must already be resized to width x height.
+*/
+func GenerateEdges(img *image.Gray, edges *utils.EdgeMap, colors *image.RGBA, alpha [][]uint8, width, height int, charset *Charset, threshold float64, mode ColorMode) string {
+	var builder strings.Builder
+
+	for y := 0; y < height; y++ {
+		current := ""
+		for x := 0; x < width; x++ {
+			if alpha != nil && alpha[y][x] == 0 {
+				builder.WriteString(" ")
+				continue
+			}
+
+			if mode != ColorNone {
+				writeColor(&builder, colors.RGBAAt(x, y), mode, &current)
+			}
+
+			i := y*width + x
+			if edges.Magnitude[i] >= threshold {
+				builder.WriteString(edgeGlyph(edges.Gx[i], edges.Gy[i], edges.Lower[i]))
+			} else {
+				builder.WriteString(getASCIIChar(img.GrayAt(x, y), charset))
+			}
+		}
+		if mode != ColorNone {
+			builder.WriteString(sgrReset)
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// GlyphFace is a font face that can also tell which characters the font actually has.
+type GlyphFace struct {
+	font.Face
+	font *sfnt.Font
+}
+
+// HasGlyph reports whether the font has a glyph for r, rather than falling back to the missing glyph box.
+func (f *GlyphFace) HasGlyph(r rune) bool {
+	var buf sfnt.Buffer
+	index, err := f.font.GlyphIndex(&buf, r)
+	return err == nil && index != 0
+}
+
+// LoadFace loads a TrueType or OpenType font at the given size in pixels. An empty path uses the bundled Go Mono font.
+func LoadFace(path string, size float64) (*GlyphFace, error) {
+	data := gomono.TTF
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading font: %v", err)
+		}
+	}
+
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing font: %v", err)
+	}
+
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating font face: %v", err)
+	}
+
+	return &GlyphFace{Face: face, font: parsed}, nil
+}
+
+// CellBounds returns the size in pixels of one character cell of a monospace face and the baseline offset.
+func CellBounds(face font.Face) (width, height, ascent int) {
+	metrics := face.Metrics()
+	advance, ok := face.GlyphAdvance('M')
+	if !ok {
+		advance = metrics.Height / 2
+	}
+
+	return advance.Ceil(), (metrics.Ascent + metrics.Descent).Ceil(), metrics.Ascent.Ceil()
+}
+
+// RasterizeGlyph draws a glyph into a single character cell and returns its coverage mask, where 255 is full ink.
+// It returns false if the font has no glyph for the character.
+func RasterizeGlyph(face *GlyphFace, glyph string) (*image.Gray, bool) {
+	width, height, ascent := CellBounds(face)
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+
+	for _, r := range glyph {
+		if !face.HasGlyph(r) {
+			return mask, false
+		}
+	}
+
+	drawer := font.Drawer{
+		Dst:  mask,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(0, ascent),
+	}
+	drawer.DrawString(glyph)
+
+	return mask, true
+}
+
+// coverage returns the fraction of the mask covered by ink (0 - 1).
+func coverage(mask *image.Gray) float64 {
+	var sum int
+	for _, v := range mask.Pix {
+		sum += int(v)
+	}
+
+	return float64(sum) / float64(255*len(mask.Pix))
+}
@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"image"
+	"strings"
+)
+
+const (
+	upperHalf = "▀"
+	lowerHalf = "▄"
+)
+
+/*
+	Generates half-block art from a color image. Every cell shows two square pixels: the upper half block
+	is drawn with the foreground set to the top pixel and the background set to the bottom pixel.
+	width and height are the size of the pixel grid, so the output has height/2 rows.
+
+	Transparent pixels keep the terminal background. When only one half of a cell is visible, that half
+	is drawn with the matching half block and the default background.
+*/
+func GenerateHalfBlock(colors *image.RGBA, alpha [][]uint8, width, height int, mode ColorMode) string {
+	var builder strings.Builder
+	rows := height / 2
+
+	for row := 0; row < rows; row++ {
+		current := "0" // every line starts from the reset written at the end of the previous one
+		for x := 0; x < width; x++ {
+			top := colors.RGBAAt(x, row*2)
+			bottom := colors.RGBAAt(x, row*2+1)
+
+			topVisible, bottomVisible := true, true
+			if alpha != nil {
+				topVisible = alpha[row*2][x] != 0
+				bottomVisible = alpha[row*2+1][x] != 0
+			}
+
+			var params, glyph string
+			switch {
+			case topVisible && bottomVisible:
+				params = sgrParams(top, mode, false) + ";" + sgrParams(bottom, mode, true)
+				glyph = upperHalf
+			case topVisible:
+				params = sgrParams(top, mode, false) + ";49"
+				glyph = upperHalf
+			case bottomVisible:
+				params = sgrParams(bottom, mode, false) + ";49"
+				glyph = lowerHalf
+			default:
+				params = "0"
+				glyph = " "
+			}
+
+			if params != current {
+				builder.WriteString("\033[" + params + "m")
+				current = params
+			}
+			builder.WriteString(glyph)
+		}
+		builder.WriteString(sgrReset)
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
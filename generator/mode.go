@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RenderMode int
+
+const (
+	ModeASCII RenderMode = iota
+	ModeBraille
+	ModeHalfBlock
+	ModeEdges
+	ModeShape
+)
+
+// ParseRenderMode converts the value of the --mode flag to a RenderMode.
+func ParseRenderMode(mode string) (RenderMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "ascii":
+		return ModeASCII, nil
+	case "braille":
+		return ModeBraille, nil
+	case "halfblock", "half":
+		return ModeHalfBlock, nil
+	case "edges", "edge":
+		return ModeEdges, nil
+	case "shape", "shapes":
+		return ModeShape, nil
+	default:
+		return ModeASCII, fmt.Errorf("unknown render mode \"%s\"", mode)
+	}
+}
+
+// String returns the name of the render mode, as accepted by ParseRenderMode.
+func (mode RenderMode) String() string {
+	switch mode {
+	case ModeBraille:
+		return "braille"
+	case ModeHalfBlock:
+		return "halfblock"
+	case ModeEdges:
+		return "edges"
+	case ModeShape:
+		return "shape"
+	default:
+		return "ascii"
+	}
+}
+
+// CellSize returns how many pixels of the resized image are packed into a single character cell.
+func CellSize(mode RenderMode) (int, int) {
+	switch mode {
+	case ModeBraille:
+		return 2, 4
+	case ModeHalfBlock:
+		return 1, 2
+	case ModeShape:
+		return ShapeCellWidth, ShapeCellHeight
+	default:
+		return 1, 1
+	}
+}
@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// ansiState is the foreground and background selected by the SGR sequences read so far. nil means the default color.
+type ansiState struct {
+	fg, bg *color.RGBA
+}
+
+// paletteColor returns the RGB value of an entry of the 256 color palette.
+func paletteColor(n int) color.RGBA {
+	switch {
+	case n < 16:
+		p := ansi16Palette[n]
+		return color.RGBA{p[0], p[1], p[2], 255}
+	case n < 232:
+		n -= 16
+		return color.RGBA{cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6], 255}
+	default:
+		level := uint8(8 + 10*(n-232))
+		return color.RGBA{level, level, level, 255}
+	}
+}
+
+// apply updates the state with the parameters of one SGR sequence, e.g. "38;2;255;0;0".
+func (s *ansiState) apply(params string) {
+	fields := strings.Split(params, ";")
+	values := make([]int, len(fields))
+	for i, f := range fields {
+		values[i], _ = strconv.Atoi(f)
+	}
+
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		var c color.RGBA
+		switch {
+		case v == 0:
+			s.fg, s.bg = nil, nil
+			continue
+		case v == 39:
+			s.fg = nil
+			continue
+		case v == 49:
+			s.bg = nil
+			continue
+		case (v == 38 || v == 48) && i+2 < len(values) && values[i+1] == 5:
+			c = paletteColor(values[i+2] & 0xFF)
+			i += 2
+		case (v == 38 || v == 48) && i+4 < len(values) && values[i+1] == 2:
+			c = color.RGBA{uint8(values[i+2]), uint8(values[i+3]), uint8(values[i+4]), 255}
+			i += 4
+		case v >= 30 && v <= 37, v >= 40 && v <= 47:
+			c = paletteColor(v % 10)
+		case v >= 90 && v <= 97, v >= 100 && v <= 107:
+			c = paletteColor(8 + v%10)
+		default:
+			continue
+		}
+
+		if v == 38 || (v >= 30 && v <= 37) || (v >= 90 && v <= 97) {
+			s.fg = &c
+		} else {
+			s.bg = &c
+		}
+	}
+}
+
+// artCell is one character of the art with the colors it is drawn with.
+type artCell struct {
+	glyph rune
+	fg    color.RGBA
+	bg    *color.RGBA
+}
+
+// parseArt splits the art into rows of cells, resolving the ANSI colors of every character.
+func parseArt(art string, fg color.RGBA) [][]artCell {
+	var rows [][]artCell
+	var state ansiState
+
+	lines := strings.Split(strings.TrimRight(art, "\n"), "\n")
+	for _, line := range lines {
+		var row []artCell
+		for i := 0; i < len(line); {
+			if strings.HasPrefix(line[i:], "\033[") {
+				end := strings.IndexByte(line[i:], 'm')
+				if end == -1 {
+					break
+				}
+				state.apply(line[i+2 : i+end])
+				i += end + 1
+				continue
+			}
+
+			r, size := utf8.DecodeRuneInString(line[i:])
+			cell := artCell{glyph: r, fg: fg, bg: state.bg}
+			if state.fg != nil {
+				cell.fg = *state.fg
+			}
+			row = append(row, cell)
+			i += size
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// drawBlock draws the block and braille characters as shapes, so they line up without gaps whatever the font.
+func drawBlock(dst *image.RGBA, r rune, cell image.Rectangle, fg color.RGBA) bool {
+	src := image.NewUniform(fg)
+	w, h := cell.Dx(), cell.Dy()
+
+	switch {
+	case r == '█':
+		draw.Draw(dst, cell, src, image.Point{}, draw.Over)
+	case r == '▀':
+		draw.Draw(dst, image.Rect(cell.Min.X, cell.Min.Y, cell.Max.X, cell.Min.Y+h/2), src, image.Point{}, draw.Over)
+	case r == '▄':
+		draw.Draw(dst, image.Rect(cell.Min.X, cell.Min.Y+h/2, cell.Max.X, cell.Max.Y), src, image.Point{}, draw.Over)
+	case r >= brailleBase && r <= brailleBase+0xFF:
+		pattern := r - brailleBase
+		dot := max(1, min(w/4, h/8))
+		for dy := 0; dy < 4; dy++ {
+			for dx := 0; dx < 2; dx++ {
+				if pattern&brailleDots[dy][dx] == 0 {
+					continue
+				}
+				cx := cell.Min.X + w*(2*dx+1)/4
+				cy := cell.Min.Y + h*(2*dy+1)/8
+				draw.Draw(dst, image.Rect(cx-dot, cy-dot, cx+dot, cy+dot), src, image.Point{}, draw.Over)
+			}
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+/*
+	RasterizeArt draws generated art into an image with a monospace font. Every character gets a cell of the
+	font's size, so the image has exactly as many columns and rows as the text. ANSI colors in the art are kept,
+	uncolored characters use fg and the whole image starts filled with bg.
+*/
+func RasterizeArt(art string, face *GlyphFace, fg, bg color.RGBA) *image.RGBA {
+	rows := parseArt(art, fg)
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+
+	cellW, cellH, ascent := CellBounds(face)
+	img := image.NewRGBA(image.Rect(0, 0, max(1, cols*cellW), max(1, len(rows)*cellH)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	drawer := font.Drawer{Dst: img, Face: face}
+	for y, row := range rows {
+		for x, cell := range row {
+			bounds := image.Rect(x*cellW, y*cellH, (x+1)*cellW, (y+1)*cellH)
+			if cell.bg != nil {
+				draw.Draw(img, bounds, image.NewUniform(*cell.bg), image.Point{}, draw.Src)
+			}
+			if cell.glyph == ' ' || drawBlock(img, cell.glyph, bounds, cell.fg) {
+				continue
+			}
+
+			drawer.Src = image.NewUniform(cell.fg)
+			drawer.Dot = fixed.P(bounds.Min.X, bounds.Min.Y+ascent)
+			drawer.DrawString(string(cell.glyph))
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,230 @@
+package generator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Size in pixels of the patch every glyph is compared against. Twice as tall as wide, like a terminal cell.
+const (
+	ShapeCellWidth  = 4
+	ShapeCellHeight = 8
+	shapePixels     = ShapeCellWidth * ShapeCellHeight
+)
+
+// SSIM stabilizing constants for 8 bit values
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// Patches are quantized to 8 levels per pixel before matching, so the 32 pixels fit in a 96 bit cache key.
+const (
+	shapeQuantBits = 3
+	shapeCacheSize = 1 << 16
+)
+
+type shapeKey [2]uint64
+
+/*
+	Patches whose pixels vary less than this have no shape to match, SSIM would then only tell the darkest glyph
+	from the rest. They take the glyph of their brightness from the charset instead, like ascii mode. A patch
+	split between two neighbouring quantized levels stays below it.
+*/
+const shapeFlatVariance = 20 * 20
+
+/*
+	ShapeMatcher picks the glyph whose shape looks most like a patch of the image. Every glyph is rasterized to
+	a ShapeCellWidth x ShapeCellHeight bitmap once, with its mean and zero-mean pixels kept, so scoring a
+	patch against a glyph costs a single dot product. Flat patches are drawn from the charset by brightness.
+	Results are cached by quantized patch, which makes the flat and repeated areas of a video almost free.
+*/
+type ShapeMatcher struct {
+	charset  *Charset
+	glyphs   []string
+	means    []float64
+	variance []float64
+	centered [][shapePixels]float64
+
+	mu    sync.RWMutex
+	cache map[shapeKey]string
+}
+
+// downsampleMask averages a glyph mask down to the shape patch size.
+func downsampleMask(mask *image.Gray) [shapePixels]float64 {
+	var bitmap [shapePixels]float64
+	width, height := mask.Bounds().Dx(), mask.Bounds().Dy()
+
+	for py := 0; py < ShapeCellHeight; py++ {
+		y1, y2 := py*height/ShapeCellHeight, max((py+1)*height/ShapeCellHeight, py*height/ShapeCellHeight+1)
+		for px := 0; px < ShapeCellWidth; px++ {
+			x1, x2 := px*width/ShapeCellWidth, max((px+1)*width/ShapeCellWidth, px*width/ShapeCellWidth+1)
+
+			var sum, count int
+			for y := y1; y < y2; y++ {
+				for x := x1; x < x2; x++ {
+					sum += int(mask.Pix[y*mask.Stride+x])
+					count++
+				}
+			}
+			bitmap[py*ShapeCellWidth+px] = float64(sum) / float64(count)
+		}
+	}
+
+	return bitmap
+}
+
+// NewShapeMatcher rasterizes the glyphs of the charset with the face. Glyphs the font cannot draw are left out.
+func NewShapeMatcher(face *GlyphFace, charset *Charset) (*ShapeMatcher, error) {
+	matcher := &ShapeMatcher{charset: charset, cache: make(map[shapeKey]string)}
+	seen := map[string]bool{}
+
+	for _, glyph := range charset.glyphs {
+		if seen[glyph] {
+			continue
+		}
+		seen[glyph] = true
+
+		mask, ok := RasterizeGlyph(face, glyph)
+		if !ok {
+			continue
+		}
+
+		bitmap := downsampleMask(mask)
+		mean, variance := patchStats(bitmap[:])
+		for i := range bitmap {
+			bitmap[i] -= mean
+		}
+
+		matcher.glyphs = append(matcher.glyphs, glyph)
+		matcher.means = append(matcher.means, mean)
+		matcher.variance = append(matcher.variance, variance)
+		matcher.centered = append(matcher.centered, bitmap)
+	}
+
+	if len(matcher.glyphs) < 2 {
+		return nil, fmt.Errorf("the font can draw fewer than 2 of the characters")
+	}
+
+	return matcher, nil
+}
+
+func patchStats(patch []float64) (mean, variance float64) {
+	for _, v := range patch {
+		mean += v
+	}
+	mean /= float64(len(patch))
+
+	for _, v := range patch {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(patch))
+
+	return mean, variance
+}
+
+// match returns the glyph with the highest SSIM against the patch, or the glyph of its brightness if it is flat.
+func (m *ShapeMatcher) match(patch *[shapePixels]float64) string {
+	mean, variance := patchStats(patch[:])
+	if variance < shapeFlatVariance {
+		return getASCIIChar(color.Gray{Y: uint8(mean)}, m.charset)
+	}
+
+	best, bestScore := 0, math.Inf(-1)
+	for g, centered := range m.centered {
+		var covariance float64
+		for i, v := range patch {
+			covariance += v * centered[i]
+		}
+		covariance /= shapePixels
+
+		luminance := (2*mean*m.means[g] + ssimC1) / (mean*mean + m.means[g]*m.means[g] + ssimC1)
+		structure := (2*covariance + ssimC2) / (variance + m.variance[g] + ssimC2)
+		if score := luminance * structure; score > bestScore {
+			best, bestScore = g, score
+		}
+	}
+
+	return m.glyphs[best]
+}
+
+// Glyph returns the glyph that best matches the patch, quantizing it and using the cache when possible.
+func (m *ShapeMatcher) Glyph(patch *[shapePixels]float64) string {
+	var key shapeKey
+	for i, v := range patch {
+		level := uint64(v) >> (8 - shapeQuantBits)
+		bit := i * shapeQuantBits
+		key[bit/64] |= level << (bit % 64)
+		if bit%64 > 64-shapeQuantBits {
+			key[bit/64+1] |= level >> (64 - bit%64)
+		}
+		// Match on the quantized value, so a cached answer is the same as a fresh one
+		patch[i] = float64(level<<(8-shapeQuantBits)) + float64(int(1)<<(8-shapeQuantBits-1))
+	}
+
+	m.mu.RLock()
+	glyph, cached := m.cache[key]
+	m.mu.RUnlock()
+	if cached {
+		return glyph
+	}
+
+	glyph = m.match(patch)
+
+	m.mu.Lock()
+	if len(m.cache) >= shapeCacheSize {
+		m.cache = make(map[shapeKey]string)
+	}
+	m.cache[key] = glyph
+	m.mu.Unlock()
+
+	return glyph
+}
+
+/*
+	Generates ASCII art by shape. Every ShapeCellWidth x ShapeCellHeight block of the grayscale image is
+	compared to the rasterized glyphs, and the glyph with the most similar structure is used, so edges and
+	diagonals keep their direction. Flat blocks keep their brightness like in ascii mode. width and height are the size of the pixel grid.
+*/
+func GenerateShapes(img *image.Gray, matcher *ShapeMatcher, colors *image.RGBA, alpha [][]uint8, width, height int, mode ColorMode) string {
+	var builder strings.Builder
+	cols, rows := width/ShapeCellWidth, height/ShapeCellHeight
+
+	var patch [shapePixels]float64
+	for row := 0; row < rows; row++ {
+		current := ""
+		for col := 0; col < cols; col++ {
+			x0, y0 := col*ShapeCellWidth, row*ShapeCellHeight
+
+			visible := alpha == nil
+			for dy := 0; dy < ShapeCellHeight; dy++ {
+				for dx := 0; dx < ShapeCellWidth; dx++ {
+					patch[dy*ShapeCellWidth+dx] = float64(img.GrayAt(x0+dx, y0+dy).Y)
+					if alpha != nil && alpha[y0+dy][x0+dx] != 0 {
+						visible = true
+					}
+				}
+			}
+
+			if !visible {
+				builder.WriteString(" ")
+				continue
+			}
+
+			if mode != ColorNone {
+				writeColor(&builder, averageBlock(colors, x0, y0, ShapeCellWidth, ShapeCellHeight), mode, &current)
+			}
+			builder.WriteString(matcher.Glyph(&patch))
+		}
+		if mode != ColorNone {
+			builder.WriteString(sgrReset)
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
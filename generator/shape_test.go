@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestShapeGradientKeepsTones(t *testing.T) {
+	face, err := LoadFace("", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+
+	charset, err := NewCharset(SplitGlyphs(" .:-=+*#%@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher, err := NewShapeMatcher(face, charset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A horizontal gradient from black to white, 80 cells wide
+	width, height := 80*ShapeCellWidth, ShapeCellHeight
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x * 255 / (width - 1))})
+		}
+	}
+
+	// Flat cells are drawn by brightness, so the gradient goes through most of the ramp instead of . and @
+	art := GenerateShapes(img, matcher, nil, nil, width, height, ColorNone)
+	glyphs := map[rune]bool{}
+	for _, r := range strings.TrimRight(art, "\n") {
+		glyphs[r] = true
+	}
+	if len(glyphs) <= len(charset.glyphs)/2 {
+		t.Errorf("gradient drawn with %d of %d glyphs: %q", len(glyphs), len(charset.glyphs), art)
+	}
+}
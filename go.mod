@@ -3,6 +3,7 @@ module github.com/JoelVCrasta/goskii
 go 1.22.5
 
 require (
+	github.com/kkdai/youtube/v2 v2.10.2
 	github.com/spf13/cobra v1.8.1
 	github.com/u2takey/ffmpeg-go v0.5.0
 	golang.org/x/image v0.23.0
@@ -18,7 +19,6 @@ require (
 	github.com/google/pprof v0.0.0-20241203143554-1e3fdc7de467 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/kkdai/youtube/v2 v2.10.2 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
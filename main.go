@@ -1,33 +1,107 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/JoelVCrasta/goskii/cmd"
 	"github.com/JoelVCrasta/goskii/convertor"
 	"github.com/JoelVCrasta/goskii/utils"
 )
 
-func main() {
-	cmd.Execute()
+// Exit status of a run that failed. Interrupted runs exit with 128 plus the signal number, as shells report them.
+const exitError = 1
+
+// signalError is the cause of the cancellation of a run stopped by a signal.
+type signalError struct {
+	signal os.Signal
+}
+
+func (e signalError) Error() string {
+	return fmt.Sprintf("stopped by %v", e.signal)
+}
+
+/*
+	signalContext returns a context that is cancelled when SIGINT or SIGTERM is received, with a signalError as
+	its cause. Only the first signal is caught, a second one kills goskii right away.
+*/
+func signalContext() (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(signalError{signal: sig})
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
+// exitCode returns the exit status for the error a run ended with.
+func exitCode(err error) int {
+	var sigErr signalError
+	if errors.As(err, &sigErr) {
+		if sig, ok := sigErr.signal.(syscall.Signal); ok {
+			return 128 + int(sig)
+		}
+	}
+	if errors.Is(err, utils.ErrInterrupted) {
+		return 128 + int(syscall.SIGINT)
+	}
+
+	return exitError
+}
+
+func run(ctx context.Context) error {
 	cmdFlags := cmd.GetCommands()
 	ftype := cmd.GetFileType()
 
 	if cmdFlags.Path != "" {
 		if ftype == 0 {
-			err := convertor.ImageToASCII(cmdFlags)
-			if err != nil {
-				fmt.Print(err)
-			}
+			return convertor.ImageToASCII(ctx, cmdFlags)
 		} else if ftype == 1 || ftype == 3 {
-			err := convertor.VideoToASCII(cmdFlags)
-			if err != nil {
-				fmt.Print(err)
-			}
+			return convertor.VideoToASCII(ctx, cmdFlags)
 		} else {
-			fmt.Print("Invalid file type")
+			return errors.New("Invalid file type")
 		}
 	} else if cmdFlags.Render != "" {
-		utils.Render(cmdFlags.Render, cmdFlags.Fps)
+		return utils.Render(ctx, cmdFlags.Render, cmdFlags.Fps)
+	}
+
+	return nil
+}
+
+func main() {
+	cmd.Execute()
+
+	ctx, cancel := signalContext()
+	err := run(ctx)
+
+	// Errors of commands killed by the cancellation only repeat that goskii was interrupted
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	cancel(nil)
+
+	if errors.Is(err, utils.ErrQuit) {
+		err = nil
+	}
+
+	if err != nil {
+		// An interruption is no error to report
+		code := exitCode(err)
+		if code == exitError {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(code)
 	}
-}
\ No newline at end of file
+}
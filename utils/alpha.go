@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+/*
+	HasAlpha returns whether an image has transparent pixels. Color models without an alpha channel are opaque
+	right away. Images with one are opaque only if every pixel is, which the image types of the standard library
+	check with their Opaque method.
+*/
+func HasAlpha(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model, color.YCbCrModel, color.CMYKModel:
+		return false
+	}
+
+	if palette, ok := img.ColorModel().(color.Palette); ok {
+		transparent := false
+		for _, c := range palette {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				transparent = true
+				break
+			}
+		}
+		if !transparent {
+			return false
+		}
+	}
+
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	return true
+}
+
+// Composite draws an image over a background color, which leaves no transparent pixel.
+func Composite(img image.Image, background color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	composite := image.NewRGBA(bounds)
+
+	draw.Draw(composite, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(composite, bounds, img, bounds.Min, draw.Over)
+
+	return composite
+}
+
+// ThresholdAlpha makes the values of an alpha grid below threshold fully transparent, and the others opaque.
+func ThresholdAlpha(alpha [][]uint8, threshold uint8) {
+	for _, row := range alpha {
+		for x, a := range row {
+			if a < threshold {
+				row[x] = 0
+			} else {
+				row[x] = 255
+			}
+		}
+	}
+}
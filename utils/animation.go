@@ -0,0 +1,508 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// Frames shorter than minFrameDelay are stretched to it. GIF frames with a delay of 0 or 10ms play for
+// defaultFrameDelay, as they do in browsers.
+const (
+	minFrameDelay     = 20 * time.Millisecond
+	defaultFrameDelay = 100 * time.Millisecond
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// What becomes of the area of a frame once it has been shown.
+const (
+	disposeNone       = iota
+	disposeBackground // Cleared to transparent
+	disposePrevious   // Restored to what it was before the frame
+)
+
+// A frame of an animation, decoded only when it is composited.
+type animationFrame struct {
+	rect    image.Rectangle
+	blend   bool // Drawn over the canvas instead of replacing the pixels under it
+	dispose int
+	decode  func() (image.Image, error)
+}
+
+/*
+	Animation is an animated GIF, APNG or WebP. Loading it only reads where its frames are, they are decoded and
+	composited one at a time by Composite, so memory use doesn't grow with the number of frames.
+*/
+type Animation struct {
+	Width     int // Size of the frames, once turned as the EXIF orientation says
+	Height    int
+	Durations []time.Duration // How long every frame is shown
+
+	canvas      image.Rectangle
+	frames      []animationFrame
+	orientation Orientation
+}
+
+// Len returns the number of frames.
+func (a *Animation) Len() int {
+	return len(a.frames)
+}
+
+/*
+	Composite decodes the frames in order and draws each one on the canvas, over what the frames before it left
+	after their disposal, then calls send with a copy of the canvas, which send may keep. It returns early when
+	send returns false, and with the error of a frame that can't be decoded. Every call starts from an empty
+	canvas.
+*/
+func (a *Animation) Composite(send func(image.Image, time.Duration) bool) error {
+	canvas := image.NewRGBA(a.canvas)
+	for i, frame := range a.frames {
+		img, err := frame.decode()
+		if err != nil {
+			return err
+		}
+
+		var previous *image.RGBA
+		if frame.dispose == disposePrevious {
+			previous = image.NewRGBA(frame.rect)
+			draw.Draw(previous, frame.rect, canvas, frame.rect.Min, draw.Src)
+		}
+
+		op := draw.Src
+		if frame.blend {
+			op = draw.Over
+		}
+		draw.Draw(canvas, frame.rect, img, img.Bounds().Min, op)
+
+		snapshot := image.NewRGBA(canvas.Rect)
+		copy(snapshot.Pix, canvas.Pix)
+		if !send(Orient(snapshot, a.orientation), a.Durations[i]) {
+			return nil
+		}
+
+		switch frame.dispose {
+		case disposeBackground:
+			draw.Draw(canvas, frame.rect, image.Transparent, image.Point{}, draw.Src)
+		case disposePrevious:
+			draw.Draw(canvas, frame.rect, previous, frame.rect.Min, draw.Src)
+		}
+	}
+
+	return nil
+}
+
+// first returns the first frame, composited.
+func (a *Animation) first() (image.Image, error) {
+	var first image.Image
+	err := a.Composite(func(img image.Image, _ time.Duration) bool {
+		first = img
+		return false
+	})
+
+	return first, err
+}
+
+// setOrientation makes Composite turn the frames as the orientation says.
+func (a *Animation) setOrientation(o Orientation) {
+	a.orientation = o
+	a.Width, a.Height = a.canvas.Dx(), a.canvas.Dy()
+	if o.SwapsAxes() {
+		a.Width, a.Height = a.Height, a.Width
+	}
+}
+
+/*
+	parseAnimation finds the frames of an animated GIF, APNG or animated WebP without decoding them. It returns
+	nil if the data is not one of these formats or not animated. An animated WebP can have a single frame, which
+	x/image/webp can't decode on its own.
+*/
+func parseAnimation(data []byte) (*Animation, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return parseGIF(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return parseAPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return parseAnimatedWebP(data)
+	default:
+		return nil, nil
+	}
+}
+
+func newAnimation(width, height int) *Animation {
+	a := &Animation{canvas: image.Rect(0, 0, width, height)}
+	a.setOrientation(OrientNormal)
+
+	return a
+}
+
+// add appends a frame at rect, which has to lie on the canvas. Frames shorter than minFrameDelay are stretched to it.
+func (a *Animation) add(frame animationFrame, duration time.Duration) error {
+	if !frame.rect.In(a.canvas) {
+		return fmt.Errorf("frame %d at %v is outside of the %dx%d canvas", len(a.frames), frame.rect, a.canvas.Dx(), a.canvas.Dy())
+	}
+
+	a.frames = append(a.frames, frame)
+	a.Durations = append(a.Durations, max(duration, minFrameDelay))
+
+	return nil
+}
+
+/*
+	parseGIF walks the blocks of a GIF up to the trailer, skipping the color tables and the data sub-blocks.
+	Every frame is cut out into a standalone GIF, with the header and global color table of the file and the
+	graphic control extension of the frame, and decoded with image/gif. A frame cut short ends the animation.
+*/
+func parseGIF(data []byte) (*Animation, error) {
+	if len(data) < 13 {
+		return nil, nil
+	}
+
+	colorTable := func(flags byte) int {
+		if flags&0x80 == 0 {
+			return 0
+		}
+		return 3 << (flags&0x07 + 1)
+	}
+
+	// Skips data sub-blocks, up to and including the empty one that ends them
+	subBlocks := func(i int) int {
+		for i < len(data) && data[i] != 0 {
+			i += int(data[i]) + 1
+		}
+		return i + 1
+	}
+
+	header := data[:min(13+colorTable(data[10]), len(data))]
+	width, height := int(binary.LittleEndian.Uint16(data[6:])), int(binary.LittleEndian.Uint16(data[8:]))
+	a := newAnimation(width, height)
+
+	var control []byte // Graphic control extension of the next frame
+blocks:
+	for i := len(header); i < len(data); {
+		switch data[i] {
+		case 0x21: // extension
+			end := subBlocks(i + 2)
+			if end > len(data) {
+				break blocks
+			}
+			if data[i+1] == 0xf9 && end-i >= 8 {
+				control = data[i:end]
+			}
+			i = end
+		case 0x2c: // image descriptor
+			if i+10 > len(data) {
+				break blocks
+			}
+			end := subBlocks(i + 10 + colorTable(data[i+9]) + 1)
+			if end > len(data) {
+				break blocks
+			}
+
+			x, y := int(binary.LittleEndian.Uint16(data[i+1:])), int(binary.LittleEndian.Uint16(data[i+3:]))
+			w, h := int(binary.LittleEndian.Uint16(data[i+5:])), int(binary.LittleEndian.Uint16(data[i+7:]))
+
+			duration, dispose := defaultFrameDelay, disposeNone
+			if control != nil {
+				if delay := binary.LittleEndian.Uint16(control[4:]); delay > 1 {
+					duration = time.Duration(delay) * 10 * time.Millisecond
+				}
+				switch (control[3] >> 2) & 0x07 {
+				case gif.DisposalBackground:
+					dispose = disposeBackground
+				case gif.DisposalPrevious:
+					dispose = disposePrevious
+				}
+			}
+
+			frame := make([]byte, 0, len(header)+len(control)+end-i+1)
+			frame = append(append(append(append(frame, header...), control...), data[i:end]...), 0x3b)
+			index := a.Len()
+			err := a.add(animationFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				blend:   true,
+				dispose: dispose,
+				decode: func() (image.Image, error) {
+					img, err := gif.Decode(bytes.NewReader(frame))
+					if err != nil {
+						return nil, fmt.Errorf("error decoding GIF frame %d: %v", index, err)
+					}
+					return img, nil
+				},
+			}, duration)
+			if err != nil {
+				return nil, err
+			}
+
+			control = nil
+			i = end
+		default: // trailer
+			break blocks
+		}
+	}
+
+	if a.Len() < 2 {
+		return nil, nil
+	}
+
+	return a, nil
+}
+
+// A PNG chunk, without its length and CRC.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := int(binary.BigEndian.Uint32(data))
+		if length > len(data)-12 {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+
+		chunks = append(chunks, pngChunk{kind: string(data[4:8]), data: data[8 : 8+length]})
+		data = data[12+length:]
+	}
+
+	return chunks, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(kind)
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// The frame control chunk of an APNG frame.
+type apngFrame struct {
+	rect     image.Rectangle
+	duration time.Duration
+	dispose  byte // 0 none, 1 background, 2 previous
+	blend    byte // 0 source, 1 over
+	data     [][]byte
+}
+
+/*
+	parseAPNG finds the frames of an animated PNG. Each frame is rebuilt into a standalone PNG from the header
+	and palette chunks of the file and the frame's own size and image data, and decoded with image/png.
+*/
+func parseAPNG(data []byte) (*Animation, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		header   []byte
+		shared   []pngChunk // PLTE, tRNS and the other chunks every frame needs
+		frames   []*apngFrame
+		current  *apngFrame
+		animated bool
+	)
+
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "IHDR":
+			header = chunk.data
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if len(chunk.data) < 26 {
+				return nil, fmt.Errorf("invalid APNG frame control chunk")
+			}
+			d := chunk.data
+			width, height := int(binary.BigEndian.Uint32(d[4:])), int(binary.BigEndian.Uint32(d[8:]))
+			x, y := int(binary.BigEndian.Uint32(d[12:])), int(binary.BigEndian.Uint32(d[16:]))
+			num, den := binary.BigEndian.Uint16(d[20:]), binary.BigEndian.Uint16(d[22:])
+			if den == 0 {
+				den = 100
+			}
+
+			current = &apngFrame{
+				rect:     image.Rect(x, y, x+width, y+height),
+				duration: time.Duration(num) * time.Second / time.Duration(den),
+				dispose:  d[24],
+				blend:    d[25],
+			}
+			frames = append(frames, current)
+		case "IDAT":
+			// The default image is only part of the animation if a frame control chunk comes before it
+			if current != nil {
+				current.data = append(current.data, chunk.data)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return nil, fmt.Errorf("invalid APNG frame data chunk")
+			}
+			current.data = append(current.data, chunk.data[4:])
+		case "IEND":
+		default:
+			if len(frames) == 0 {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+
+	if !animated || len(frames) < 2 || len(header) < 8 {
+		return nil, nil
+	}
+
+	a := newAnimation(int(binary.BigEndian.Uint32(header)), int(binary.BigEndian.Uint32(header[4:])))
+	for i, frame := range frames {
+		// A first frame disposed to previous is disposed to background, there is nothing before it
+		dispose := disposeNone
+		switch {
+		case frame.dispose == 1 || (frame.dispose == 2 && i == 0):
+			dispose = disposeBackground
+		case frame.dispose == 2:
+			dispose = disposePrevious
+		}
+
+		err := a.add(animationFrame{
+			rect:    frame.rect,
+			blend:   frame.blend == 1,
+			dispose: dispose,
+			decode: func() (image.Image, error) {
+				var buf bytes.Buffer
+				buf.Write(pngSignature)
+
+				frameHeader := append([]byte(nil), header...)
+				binary.BigEndian.PutUint32(frameHeader, uint32(frame.rect.Dx()))
+				binary.BigEndian.PutUint32(frameHeader[4:], uint32(frame.rect.Dy()))
+				writePNGChunk(&buf, "IHDR", frameHeader)
+
+				for _, chunk := range shared {
+					writePNGChunk(&buf, chunk.kind, chunk.data)
+				}
+				for _, part := range frame.data {
+					writePNGChunk(&buf, "IDAT", part)
+				}
+				writePNGChunk(&buf, "IEND", nil)
+
+				img, err := png.Decode(&buf)
+				if err != nil {
+					return nil, fmt.Errorf("error decoding APNG frame %d: %v", i, err)
+				}
+				return img, nil
+			},
+		}, frame.duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Reads a 24 bit little endian integer.
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+/*
+	parseAnimatedWebP finds the frames of an animated WebP. The image data of every ANMF chunk is wrapped into a
+	standalone WebP file, with an extended header when it has an alpha chunk, and decoded with x/image/webp.
+*/
+func parseAnimatedWebP(data []byte) (*Animation, error) {
+	var (
+		width, height int
+		animated      bool
+		a             *Animation
+	)
+
+	data = data[12:]
+	for len(data) >= 8 {
+		kind := string(data[:4])
+		length := int(binary.LittleEndian.Uint32(data[4:]))
+		if length > len(data)-8 {
+			return nil, fmt.Errorf("truncated WebP chunk")
+		}
+		chunk := data[8 : 8+length]
+		data = data[8+length+length%2:]
+
+		switch kind {
+		case "VP8X":
+			if len(chunk) < 10 {
+				return nil, fmt.Errorf("invalid WebP header chunk")
+			}
+			animated = chunk[0]&0x02 != 0
+			width, height = uint24(chunk[4:])+1, uint24(chunk[7:])+1
+		case "ANMF":
+			if !animated || len(chunk) < 16 {
+				return nil, fmt.Errorf("invalid WebP animation frame")
+			}
+			if a == nil {
+				a = newAnimation(width, height)
+			}
+
+			x, y := uint24(chunk)*2, uint24(chunk[3:])*2
+			frameWidth, frameHeight := uint24(chunk[6:])+1, uint24(chunk[9:])+1
+			duration := time.Duration(uint24(chunk[12:])) * time.Millisecond
+			flags := chunk[15]
+			frameData := chunk[16:]
+
+			dispose := disposeNone
+			if flags&0x01 != 0 {
+				dispose = disposeBackground
+			}
+
+			index := a.Len()
+			err := a.add(animationFrame{
+				rect:    image.Rect(x, y, x+frameWidth, y+frameHeight),
+				blend:   flags&0x02 == 0,
+				dispose: dispose,
+				decode: func() (image.Image, error) {
+					var buf bytes.Buffer
+					buf.WriteString("RIFF")
+					if bytes.HasPrefix(frameData, []byte("ALPH")) {
+						header := make([]byte, 10)
+						header[0] = 0x10 // alpha
+						putUint24(header[4:], frameWidth-1)
+						putUint24(header[7:], frameHeight-1)
+						binary.Write(&buf, binary.LittleEndian, uint32(4+18+len(frameData)))
+						buf.WriteString("WEBPVP8X")
+						binary.Write(&buf, binary.LittleEndian, uint32(len(header)))
+						buf.Write(header)
+					} else {
+						binary.Write(&buf, binary.LittleEndian, uint32(4+len(frameData)))
+						buf.WriteString("WEBP")
+					}
+					buf.Write(frameData)
+
+					img, err := webp.Decode(&buf)
+					if err != nil {
+						return nil, fmt.Errorf("error decoding WebP frame %d: %v", index, err)
+					}
+					return img, nil
+				},
+			}, duration)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return a, nil
+}
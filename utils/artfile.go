@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	A goskii file (.gsk) holds the frames of ASCII art with their metadata. It is plain text, so it can still be
+	read with a pager:
+
+		GOSKII 1
+		width: 80
+		height: 40
+		fps: 29.97
+		charset: 1
+		color: truecolor
+		mode: ascii
+		source: example
+		<blank line>
+		frame <duration in microseconds> <length in bytes>
+		<frame text>
+		...
+		index <number of frames>
+		<offset of the frame line> <duration in microseconds>
+		...
+		end <offset of the index line>
+
+	Frames are written as they are converted, so the index comes last. The length of every frame is in its own
+	line, so frames can contain blank lines. A file cut short, by an interrupted conversion for example, has no
+	index and is read frame by frame up to its last complete frame.
+*/
+const (
+	artFileMagic   = "GOSKII"
+	artFileVersion = 1
+
+	// ArtFileExt is the extension of goskii files.
+	ArtFileExt = ".gsk"
+)
+
+// ArtHeader is the metadata of a goskii file.
+type ArtHeader struct {
+	Version int     // Version of the format, set when reading
+	Width   int     // Width of the frames in characters, taken from the first frame when saving
+	Height  int     // Height of the frames in lines, taken from the first frame when saving
+	Fps     float64 // Frame rate of the conversion, every frame also has its own duration
+	Charset string  // Number of a built-in charset, name of a charset file, or quoted ramp of custom characters
+	Color   string // Color mode of the escape sequences in the frames, none if there are none
+	Mode    string
+	Source  string // Name of the source file
+}
+
+// An entry of the frame index.
+type artFrame struct {
+	offset   int64 // Offset of the frame line
+	start    int64 // Offset of the frame text
+	length   int
+	duration time.Duration
+}
+
+// ArtFile is an open goskii file.
+type ArtFile struct {
+	Header      ArtHeader
+	frames      []artFrame
+	framesStart int64 // Offset of the first frame, right after the header
+	file        *os.File
+}
+
+// IsArtFile returns whether the file at path starts like a goskii file.
+func IsArtFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(artFileMagic)+1)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+
+	return string(magic) == artFileMagic+" "
+}
+
+// writeArtHeader writes the header block, ending with the blank line.
+func writeArtHeader(w io.Writer, header ArtHeader) error {
+	_, err := fmt.Fprintf(
+		w,
+		"%s %d\nwidth: %d\nheight: %d\nfps: %s\ncharset: %s\ncolor: %s\nmode: %s\nsource: %s\n\n",
+		artFileMagic, artFileVersion,
+		header.Width, header.Height,
+		strconv.FormatFloat(header.Fps, 'f', -1, 64),
+		strings.ReplaceAll(header.Charset, "\n", " "), header.Color, header.Mode,
+		strings.ReplaceAll(header.Source, "\n", " "),
+	)
+
+	return err
+}
+
+/*
+	SaveFramesToArtFile writes frames to a goskii file at path as they arrive. The header is written with the first
+	frame, which gives the width and height. The frames channel is always drained, even on error.
+*/
+func SaveFramesToArtFile(frames <-chan Frame, path string, header ArtHeader) error {
+	defer func() {
+		for range frames {
+		}
+	}()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	var (
+		offset int64
+		index  []artFrame
+	)
+
+	write := func(format string, args ...any) error {
+		n, err := fmt.Fprintf(writer, format, args...)
+		offset += int64(n)
+		return err
+	}
+
+	for frame := range frames {
+		text := strings.Trim(frame.ASCII, "\n")
+
+		if index == nil {
+			lines := strings.Split(text, "\n")
+			header.Width, header.Height = VisibleWidth(lines[0]), len(lines)
+
+			counter := &countingWriter{w: writer}
+			if err := writeArtHeader(counter, header); err != nil {
+				return fmt.Errorf("error writing to file: %v", err)
+			}
+			offset += counter.n
+			index = []artFrame{}
+		}
+
+		index = append(index, artFrame{offset: offset, duration: frame.Duration})
+		if err := write("frame %d %d\n%s\n", frame.Duration.Microseconds(), len(text), text); err != nil {
+			return fmt.Errorf("error writing to file: %v", err)
+		}
+	}
+
+	if index == nil {
+		return fmt.Errorf("no frames to save")
+	}
+
+	indexOffset := offset
+	write("index %d\n", len(index))
+	for _, frame := range index {
+		write("%d %d\n", frame.offset, frame.duration.Microseconds())
+	}
+	if err := write("end %d\n", indexOffset); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// OpenArtFile opens a goskii file and reads its header and frame index.
+func OpenArtFile(path string) (*ArtFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	art := &ArtFile{file: file}
+	if err := art.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid goskii file: %v", err)
+	}
+	if err := art.readIndex(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid goskii file: %v", err)
+	}
+
+	return art, nil
+}
+
+func (a *ArtFile) Close() error {
+	return a.file.Close()
+}
+
+// readHeader parses the header block, up to the blank line. Unknown keys are ignored.
+func (a *ArtFile) readHeader() error {
+	reader := bufio.NewReader(io.NewSectionReader(a.file, 0, 1<<20))
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(line, artFileMagic+" %d\n", &a.Header.Version); err != nil {
+		return fmt.Errorf("no header")
+	}
+	if a.Header.Version > artFileVersion {
+		return fmt.Errorf("version %d is newer than this goskii supports (%d)", a.Header.Version, artFileVersion)
+	}
+
+	offset := int64(len(line))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("truncated header")
+		}
+		offset += int64(len(line))
+
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			break
+		}
+
+		key, value, _ := strings.Cut(line, ": ")
+		switch key {
+		case "width":
+			a.Header.Width, _ = strconv.Atoi(value)
+		case "height":
+			a.Header.Height, _ = strconv.Atoi(value)
+		case "fps":
+			a.Header.Fps, _ = strconv.ParseFloat(value, 64)
+		case "charset":
+			a.Header.Charset = value
+		case "color":
+			a.Header.Color = value
+		case "mode":
+			a.Header.Mode = value
+		case "source":
+			a.Header.Source = value
+		}
+	}
+
+	a.framesStart = offset
+	return nil
+}
+
+// readIndex reads the index at the end of the file, or scans the frames if the file was cut short.
+func (a *ArtFile) readIndex() error {
+	framesStart := a.framesStart
+
+	info, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	// The last line points to the index
+	tail := make([]byte, min(64, int(size-framesStart)))
+	if _, err := a.file.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return err
+	}
+
+	var indexOffset int64
+	lines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+	if _, err := fmt.Sscanf(lines[len(lines)-1], "end %d", &indexOffset); err != nil || indexOffset < framesStart || indexOffset >= size {
+		return a.scanFrames(framesStart, size)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(a.file, indexOffset, size-indexOffset))
+	var count int
+	if _, err := fmt.Fscanf(reader, "index %d\n", &count); err != nil {
+		return a.scanFrames(framesStart, size)
+	}
+
+	for i := 0; i < count; i++ {
+		var offset, duration int64
+		if _, err := fmt.Fscanf(reader, "%d %d\n", &offset, &duration); err != nil {
+			return a.scanFrames(framesStart, size)
+		}
+		a.frames = append(a.frames, artFrame{offset: offset, duration: time.Duration(duration) * time.Microsecond})
+	}
+
+	return nil
+}
+
+// scanFrames builds the index by reading the frame lines one after the other, up to the last complete frame.
+func (a *ArtFile) scanFrames(offset, size int64) error {
+	a.frames = nil
+
+	reader := bufio.NewReader(io.NewSectionReader(a.file, offset, size-offset))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "frame ") {
+			break
+		}
+
+		var duration int64
+		var length int
+		if _, err := fmt.Sscanf(line, "frame %d %d\n", &duration, &length); err != nil {
+			break
+		}
+		if _, err := reader.Discard(length + 1); err != nil {
+			break // cut in the middle of the frame
+		}
+
+		a.frames = append(a.frames, artFrame{offset: offset, duration: time.Duration(duration) * time.Microsecond})
+		offset += int64(len(line) + length + 1)
+	}
+
+	if a.frames == nil {
+		return fmt.Errorf("no frames")
+	}
+
+	return nil
+}
+
+// Len returns the number of frames.
+func (a *ArtFile) Len() int {
+	return len(a.frames)
+}
+
+// Duration returns how long frame i is shown.
+func (a *ArtFile) Duration(i int) time.Duration {
+	return a.frames[i].duration
+}
+
+// Frame reads the text of frame i.
+func (a *ArtFile) Frame(i int) (string, error) {
+	frame := &a.frames[i]
+
+	// The length is in the frame line, which is read the first time the frame is
+	if frame.start == 0 {
+		line := make([]byte, 64)
+		n, err := a.file.ReadAt(line, frame.offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		end := bytes.IndexByte(line[:n], '\n')
+		if end < 0 {
+			return "", fmt.Errorf("invalid frame %d", i)
+		}
+		var duration int64
+		if _, err := fmt.Sscanf(string(line[:end+1]), "frame %d %d\n", &duration, &frame.length); err != nil {
+			return "", fmt.Errorf("invalid frame %d", i)
+		}
+		frame.start = frame.offset + int64(end+1)
+	}
+
+	text := make([]byte, frame.length)
+	if _, err := a.file.ReadAt(text, frame.start); err != nil {
+		return "", err
+	}
+
+	return string(text), nil
+}
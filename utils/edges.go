@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"image"
+	"math"
+)
+
+// EdgeMap holds the image gradient of every pixel.
+type EdgeMap struct {
+	Width     int
+	Height    int
+	Gx        []float64
+	Gy        []float64
+	Magnitude []float64
+	Lower     []bool // only set by ResizeEdges, whether the strongest edge lies in the lower half of the cell
+}
+
+// Horizontal kernels, the vertical ones are their transpose. The sum of the positive weights is used to
+// normalize the magnitude so a full black to white step is 255 with either operator.
+var (
+	sobelKernel  = [3][3]float64{{-1, 0, 1}, {-2, 0, 2}, {-1, 0, 1}}
+	scharrKernel = [3][3]float64{{-3, 0, 3}, {-10, 0, 10}, {-3, 0, 3}}
+)
+
+// DetectEdges runs a Sobel (or Scharr) operator over a grayscale image and returns the gradient of every pixel.
+func DetectEdges(img *image.Gray, scharr bool) *EdgeMap {
+	kernel, norm := sobelKernel, 4.0
+	if scharr {
+		kernel, norm = scharrKernel, 16.0
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	edges := &EdgeMap{
+		Width:     width,
+		Height:    height,
+		Gx:        make([]float64, width*height),
+		Gy:        make([]float64, width*height),
+		Magnitude: make([]float64, width*height),
+	}
+
+	// Reads a pixel, clamping coordinates to the border
+	at := func(x, y int) float64 {
+		x = max(0, min(x, width-1))
+		y = max(0, min(y, height-1))
+		return float64(img.Pix[y*img.Stride+x])
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var gx, gy float64
+			for ky := -1; ky <= 1; ky++ {
+				for kx := -1; kx <= 1; kx++ {
+					v := at(x+kx, y+ky)
+					gx += kernel[ky+1][kx+1] * v
+					gy += kernel[kx+1][ky+1] * v
+				}
+			}
+			gx, gy = gx/norm, gy/norm
+
+			i := y*width + x
+			edges.Gx[i] = gx
+			edges.Gy[i] = gy
+			edges.Magnitude[i] = math.Hypot(gx, gy)
+		}
+	}
+
+	return edges
+}
+
+// ResizeEdges shrinks an edge map to newWidth x newHeight cells, keeping the strongest gradient found in each cell.
+func ResizeEdges(edges *EdgeMap, newWidth, newHeight int) *EdgeMap {
+	resized := &EdgeMap{
+		Width:     newWidth,
+		Height:    newHeight,
+		Gx:        make([]float64, newWidth*newHeight),
+		Gy:        make([]float64, newWidth*newHeight),
+		Magnitude: make([]float64, newWidth*newHeight),
+		Lower:     make([]bool, newWidth*newHeight),
+	}
+
+	for y := 0; y < newHeight; y++ {
+		y1 := y * edges.Height / newHeight
+		y2 := max((y+1)*edges.Height/newHeight, y1+1)
+
+		for x := 0; x < newWidth; x++ {
+			x1 := x * edges.Width / newWidth
+			x2 := max((x+1)*edges.Width/newWidth, x1+1)
+
+			best, bestY := -1, 0
+			for sy := y1; sy < y2; sy++ {
+				for sx := x1; sx < x2; sx++ {
+					i := sy*edges.Width + sx
+					if best == -1 || edges.Magnitude[i] > edges.Magnitude[best] {
+						best, bestY = i, sy
+					}
+				}
+			}
+
+			i := y*newWidth + x
+			resized.Gx[i] = edges.Gx[best]
+			resized.Gy[i] = edges.Gy[best]
+			resized.Magnitude[i] = edges.Magnitude[best]
+			resized.Lower[i] = y2-y1 > 1 && bestY-y1 >= (y2-y1)/2
+		}
+	}
+
+	return resized
+}
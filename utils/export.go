@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// gifPalette returns the web safe colors plus the text and background colors and a gray ramp for anti-aliasing.
+func gifPalette(fg, bg color.Color) color.Palette {
+	colors := make(color.Palette, 0, 256)
+	colors = append(colors, bg, fg)
+	colors = append(colors, palette.WebSafe...)
+	for len(colors) < 256 {
+		level := uint8(255 * (len(colors) - 218) / (255 - 218))
+		colors = append(colors, color.Gray{Y: level})
+	}
+
+	return colors
+}
+
+// ImageFrame is one rendered frame of ASCII art and how long it is shown.
+type ImageFrame struct {
+	Image    *image.RGBA
+	Duration time.Duration
+}
+
+// Size of the header and logical screen descriptor image/gif writes when there is no global color table.
+const gifHeaderSize = 13
+
+/*
+	gifStream writes an animated GIF one frame at a time, so frames don't pile up in memory until the end. Every
+	frame is encoded on its own by image/gif, with its palette as a local color table, and only its blocks are
+	written after the header. The first frame is held back until the second one arrives, since the loop
+	extension only follows the header of a GIF with more than one frame. The result is the same as encoding all
+	the frames at once.
+*/
+type gifStream struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	first  *gif.GIF
+}
+
+// add writes a frame shown for delay 100ths of a second.
+func (s *gifStream) add(frame *image.Paletted, delay int) error {
+	animation := &gif.GIF{Image: []*image.Paletted{frame}, Delay: []int{delay}}
+	if s.first == nil {
+		s.first = animation
+		return nil
+	}
+
+	skip := gifHeaderSize
+	if s.file == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+		animation.Image = append(s.first.Image, frame)
+		animation.Delay = append(s.first.Delay, delay)
+		skip = 0
+	}
+
+	return s.write(animation, skip)
+}
+
+func (s *gifStream) create() error {
+	file, err := os.Create(s.path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	s.file, s.writer = file, bufio.NewWriter(file)
+	return nil
+}
+
+// write encodes the frames and writes them from skip on, without the trailer.
+func (s *gifStream) write(animation *gif.GIF, skip int) error {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return fmt.Errorf("error encoding frame: %v", err)
+	}
+
+	encoded := buf.Bytes()
+	if _, err := s.writer.Write(encoded[skip : len(encoded)-1]); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+	return nil
+}
+
+// finish writes a lone first frame if there was only one, then the trailer. The file is left to close.
+func (s *gifStream) finish() error {
+	if s.first == nil {
+		return fmt.Errorf("no frames to save")
+	}
+
+	if s.file == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+		if err := s.write(s.first, 0); err != nil {
+			return err
+		}
+	}
+
+	s.writer.WriteByte(0x3b)
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+	return nil
+}
+
+/*
+	SaveToGIF encodes the frames as an animated GIF, each with its own duration, writing them as they arrive. fg
+	and bg are added to the palette so plain art keeps its exact colors. GIF delays are in 100ths of a second and
+	rounded so the total duration stays exact. Frames that would get a delay under 2 are dropped, since browsers
+	play those at 10.
+*/
+func SaveToGIF(frames <-chan ImageFrame, path string, fg, bg color.Color) error {
+	defer func() {
+		for range frames {
+		}
+	}()
+
+	stream := &gifStream{path: path}
+	defer func() {
+		if stream.file != nil {
+			stream.file.Close()
+		}
+	}()
+
+	colors := gifPalette(fg, bg)
+	indexes := map[color.RGBA]uint8{}
+
+	var (
+		elapsed time.Duration
+		shown   int // End of the frames added so far, in 100ths of a second
+	)
+
+	for imageFrame := range frames {
+		elapsed += imageFrame.Duration
+		end := int(math.Round(elapsed.Seconds() * 100))
+		if end-shown < 2 {
+			continue
+		}
+
+		frame := imageFrame.Image
+		paletted := image.NewPaletted(frame.Bounds(), colors)
+		for y := frame.Rect.Min.Y; y < frame.Rect.Max.Y; y++ {
+			for x := frame.Rect.Min.X; x < frame.Rect.Max.X; x++ {
+				c := frame.RGBAAt(x, y)
+				index, cached := indexes[c]
+				if !cached {
+					index = uint8(colors.Index(c))
+					indexes[c] = index
+				}
+				paletted.SetColorIndex(x, y, index)
+			}
+		}
+
+		if err := stream.add(paletted, end-shown); err != nil {
+			return err
+		}
+		shown = end
+	}
+
+	return stream.finish()
+}
+
+/*
+	SaveToVideo pipes the frames as raw RGBA into ffmpeg and encodes them to path at a constant fps, with H.264
+	for .mp4 and VP9 for .webm. Frames are repeated or skipped to fill the output frames that fall within their
+	duration. If audioSource is set, its audio track is muxed in and cut to the length of the frames. All frames
+	must have the size of the first one.
+*/
+func SaveToVideo(frames <-chan ImageFrame, path string, fps float64, audioSource string) error {
+	defer func() {
+		for range frames {
+		}
+	}()
+
+	first, ok := <-frames
+	if !ok {
+		return fmt.Errorf("no frames to save")
+	}
+	width, height := first.Image.Rect.Dx(), first.Image.Rect.Dy()
+
+	outputArgs := ffmpeg.KwArgs{
+		"pix_fmt": "yuv420p",
+		"vf":      "pad=ceil(iw/2)*2:ceil(ih/2)*2", // yuv420p needs even dimensions
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".webm" {
+		outputArgs["vcodec"] = "libvpx-vp9"
+		outputArgs["acodec"] = "libopus"
+	} else {
+		outputArgs["vcodec"] = "libx264"
+		outputArgs["acodec"] = "aac"
+	}
+
+	streams := []*ffmpeg.Stream{
+		ffmpeg.Input("pipe:", ffmpeg.KwArgs{
+			"format":    "rawvideo",
+			"pix_fmt":   "rgba",
+			"s":         fmt.Sprintf("%dx%d", width, height),
+			"framerate": strconv.FormatFloat(fps, 'f', -1, 64),
+		}),
+	}
+	if audioSource != "" {
+		streams = append(streams, ffmpeg.Input(audioSource).Audio())
+		outputArgs["shortest"] = ""
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		var (
+			elapsed time.Duration
+			written int
+		)
+
+		writeFrame := func(imageFrame ImageFrame) error {
+			frame := imageFrame.Image
+			if frame.Rect.Dx() != width || frame.Rect.Dy() != height {
+				return fmt.Errorf("frame size changed from %dx%d to %dx%d", width, height, frame.Rect.Dx(), frame.Rect.Dy())
+			}
+
+			elapsed += imageFrame.Duration
+			for ; time.Duration(float64(written)*float64(time.Second)/fps) < elapsed; written++ {
+				for y := 0; y < height; y++ {
+					row := frame.Pix[y*frame.Stride : y*frame.Stride+width*4]
+					if _, err := writer.Write(row); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+
+		err := writeFrame(first)
+		for frame := range frames {
+			if err == nil {
+				err = writeFrame(frame)
+			}
+		}
+		writer.CloseWithError(err)
+	}()
+
+	err := ffmpeg.Output(streams, path, outputArgs).
+		OverWriteOutput().
+		WithInput(reader).
+		Silent(true).
+		Run()
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("error encoding video: %v", err)
+	}
+
+	return nil
+}
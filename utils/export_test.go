@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveToGIFStreams(t *testing.T) {
+	for _, count := range []int{1, 3} {
+		frames := make(chan ImageFrame, count)
+		for i := 0; i < count; i++ {
+			img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+			img.SetRGBA(i, 0, color.RGBA{255, 255, 255, 255})
+			frames <- ImageFrame{Image: img, Duration: 100 * time.Millisecond}
+		}
+		close(frames)
+
+		path := filepath.Join(t.TempDir(), "art.gif")
+		if err := SaveToGIF(frames, path, color.White, color.Black); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		animation, err := gif.DecodeAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%d frames: %v", count, err)
+		}
+
+		if len(animation.Image) != count {
+			t.Errorf("saved %d frames, want %d", len(animation.Image), count)
+		}
+		for i, delay := range animation.Delay {
+			if delay != 10 {
+				t.Errorf("%d frames: frame %d has a delay of %d, want 10", count, i, delay)
+			}
+			// The text color is second in the palette
+			if animation.Image[i].ColorIndexAt(i, 0) != 1 {
+				t.Errorf("%d frames: frame %d lost its pixel", count, i)
+			}
+		}
+	}
+}
@@ -3,24 +3,37 @@ package utils
 import (
 	"image"
 	"image/color"
+	"runtime"
+	"sync"
 )
 
+// Images with fewer pixels than this are converted on one goroutine, starting more would cost more than it saves.
+const minParallelPixels = 64 * 1024
+
+// luminance returns the gray level of 16 bit per channel color values, as color.Color.RGBA returns them.
+func luminance(r, g, b uint32) uint8 {
+	lum := 0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)
+	return uint8(lum / 256)
+}
+
+// The terms of luminance for every 8 bit channel value, which are added up in the same order to the same result.
+var lumR, lumG, lumB = luminanceTable(0.299), luminanceTable(0.587), luminanceTable(0.114)
+
+func luminanceTable(weight float32) *[256]float32 {
+	var table [256]float32
+	for v := range table {
+		table[v] = weight * float32(uint32(v)*0x101)
+	}
+
+	return &table
+}
+
 // Grayscale converts an image to grayscale.
 func Grayscale(img image.Image) *image.Gray {
-    bounds := img.Bounds()
-    grayImg := image.NewGray(bounds)
+	grayImg := image.NewGray(img.Bounds())
+	convertGray(img, grayImg, nil)
 
-    for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-        for x := bounds.Min.X; x < bounds.Max.X; x++ {
-            originalColor := img.At(x, y)
-            r, g, b, _ := originalColor.RGBA()
-            lum := 0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)
-            pixel := color.Gray{uint8(lum / 256)}
-            grayImg.Set(x, y, pixel)
-        }
-    }
-
-    return grayImg
+	return grayImg
 }
 
 // GrayscaleAlpha converts an image to grayscale and returns the alpha values.
@@ -31,17 +44,189 @@ func GrayscaleAlpha(img image.Image) (*image.Gray, [][]uint8) {
 	for i := range alpha {
 		alpha[i] = make([]uint8, bounds.Dx())
 	}
+	convertGray(img, grayImg, alpha)
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			originalColor := img.At(x, y)
-			r, g, b, a := originalColor.RGBA()
-			lum := 0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)
-			pixel := color.Gray{uint8(lum / 256)}
-			grayImg.Set(x, y, pixel)
-			alpha[y][x] = uint8(a / 256)
+	return grayImg, alpha
+}
+
+/*
+	convertGray writes the gray levels of img to grayImg, and its alpha values to alpha if it isn't nil.
+
+	1) The rows are split into one band per core Go runs on, converted concurrently.
+
+	2) The pixel buffers of the common image types are read directly, without a call through color.Color for
+	every pixel: the Y plane of YCbCr already is the luminance, RGBA and NRGBA are converted with the same formula
+	as any other color, and the gray levels of a palette are computed once for all its pixels.
+
+	3) Other image types go through At, which gives the same result slower.
+*/
+func convertGray(img image.Image, grayImg *image.Gray, alpha [][]uint8) {
+	bounds := img.Bounds()
+
+	var convertRows func(y0, y1 int)
+	switch src := img.(type) {
+	case *image.Gray:
+		convertRows = func(y0, y1 int) { grayRows(src, grayImg, alpha, y0, y1) }
+	case *image.YCbCr:
+		convertRows = func(y0, y1 int) { yCbCrRows(src, grayImg, alpha, y0, y1) }
+	case *image.RGBA:
+		convertRows = func(y0, y1 int) { rgbaRows(src, grayImg, alpha, y0, y1) }
+	case *image.NRGBA:
+		convertRows = func(y0, y1 int) { nrgbaRows(src, grayImg, alpha, y0, y1) }
+	case *image.Paletted:
+		levels, opacity := paletteLevels(src.Palette)
+		convertRows = func(y0, y1 int) { palettedRows(src, levels, opacity, grayImg, alpha, y0, y1) }
+	default:
+		convertRows = func(y0, y1 int) { genericRows(img, grayImg, alpha, y0, y1) }
+	}
+
+	height := bounds.Dy()
+	bands := runtime.GOMAXPROCS(0)
+	if bounds.Dx()*height < minParallelPixels || bands < 2 {
+		convertRows(bounds.Min.Y, bounds.Max.Y)
+		return
+	}
+	bands = min(bands, height)
+
+	var wg sync.WaitGroup
+	for i := 0; i < bands; i++ {
+		y0 := bounds.Min.Y + height*i/bands
+		y1 := bounds.Min.Y + height*(i+1)/bands
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			convertRows(y0, y1)
+		}()
+	}
+	wg.Wait()
+}
+
+// opaqueRow fills the row of alpha values of y with 255, for images without an alpha channel.
+func opaqueRow(alpha [][]uint8, y int) {
+	if alpha == nil {
+		return
+	}
+
+	row := alpha[y]
+	for x := range row {
+		row[x] = 255
+	}
+}
+
+func grayRows(src *image.Gray, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := src.Rect
+	for y := y0; y < y1; y++ {
+		i := src.PixOffset(bounds.Min.X, y)
+		j := grayImg.PixOffset(bounds.Min.X, y)
+		copy(grayImg.Pix[j:j+bounds.Dx()], src.Pix[i:i+bounds.Dx()])
+		opaqueRow(alpha, y-bounds.Min.Y)
+	}
+}
+
+func yCbCrRows(src *image.YCbCr, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := src.Rect
+	for y := y0; y < y1; y++ {
+		i := src.YOffset(bounds.Min.X, y)
+		j := grayImg.PixOffset(bounds.Min.X, y)
+		copy(grayImg.Pix[j:j+bounds.Dx()], src.Y[i:i+bounds.Dx()])
+		opaqueRow(alpha, y-bounds.Min.Y)
+	}
+}
+
+func rgbaRows(src *image.RGBA, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := src.Rect
+	width := bounds.Dx()
+	for y := y0; y < y1; y++ {
+		pix := src.Pix[src.PixOffset(bounds.Min.X, y):]
+		out := grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < width; x++ {
+			p := pix[x*4 : x*4+4]
+			out[x] = uint8((lumR[p[0]] + lumG[p[1]] + lumB[p[2]]) / 256)
+		}
+
+		if alpha != nil {
+			row := alpha[y-bounds.Min.Y]
+			for x := 0; x < width; x++ {
+				row[x] = pix[x*4+3]
+			}
+		}
+	}
+}
+
+func nrgbaRows(src *image.NRGBA, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := src.Rect
+	width := bounds.Dx()
+	for y := y0; y < y1; y++ {
+		pix := src.Pix[src.PixOffset(bounds.Min.X, y):]
+		out := grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < width; x++ {
+			p := pix[x*4 : x*4+4]
+			if p[3] == 0xff {
+				out[x] = uint8((lumR[p[0]] + lumG[p[1]] + lumB[p[2]]) / 256)
+				continue
+			}
+
+			// Premultiplied the way color.NRGBA.RGBA does it
+			a := uint32(p[3])
+			r := uint32(p[0]) * 0x101 * a / 0xff
+			g := uint32(p[1]) * 0x101 * a / 0xff
+			b := uint32(p[2]) * 0x101 * a / 0xff
+			out[x] = luminance(r, g, b)
+		}
+
+		if alpha != nil {
+			row := alpha[y-bounds.Min.Y]
+			for x := 0; x < width; x++ {
+				row[x] = pix[x*4+3]
+			}
 		}
 	}
+}
 
-	return grayImg, alpha
-}	
\ No newline at end of file
+// paletteLevels returns the gray level and the alpha value of every color of a palette.
+func paletteLevels(palette color.Palette) ([256]uint8, [256]uint8) {
+	var levels, opacity [256]uint8
+	for i, c := range palette {
+		if i == len(levels) {
+			break
+		}
+		r, g, b, a := c.RGBA()
+		levels[i], opacity[i] = luminance(r, g, b), uint8(a/256)
+	}
+
+	return levels, opacity
+}
+
+func palettedRows(src *image.Paletted, levels, opacity [256]uint8, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := src.Rect
+	width := bounds.Dx()
+	for y := y0; y < y1; y++ {
+		pix := src.Pix[src.PixOffset(bounds.Min.X, y):]
+		out := grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < width; x++ {
+			out[x] = levels[pix[x]]
+		}
+
+		if alpha != nil {
+			row := alpha[y-bounds.Min.Y]
+			for x := 0; x < width; x++ {
+				row[x] = opacity[pix[x]]
+			}
+		}
+	}
+}
+
+func genericRows(img image.Image, grayImg *image.Gray, alpha [][]uint8, y0, y1 int) {
+	bounds := img.Bounds()
+	for y := y0; y < y1; y++ {
+		out := grayImg.Pix[grayImg.PixOffset(bounds.Min.X, y):]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			out[x-bounds.Min.X] = luminance(r, g, b)
+			if alpha != nil {
+				alpha[y-bounds.Min.Y][x-bounds.Min.X] = uint8(a / 256)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// atOnly hides the type of an image, so it is converted through At like any other image type.
+type atOnly struct {
+	image.Image
+}
+
+// testImages returns a random image of every type with a fast path, width x height pixels.
+func testImages(width, height int) map[string]image.Image {
+	rng := rand.New(rand.NewSource(1))
+	rect := image.Rect(0, 0, width, height)
+
+	gray := image.NewGray(rect)
+	rng.Read(gray.Pix)
+
+	// Random chroma would be colors out of the RGB range, which are clipped when converted back
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio444)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = color.RGBToYCbCr(uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)))
+	}
+
+	rgba := image.NewRGBA(rect)
+	rng.Read(rgba.Pix)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		// Premultiplied colors are never above their alpha
+		a := rgba.Pix[i+3]
+		rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2] = min8(rgba.Pix[i], a), min8(rgba.Pix[i+1], a), min8(rgba.Pix[i+2], a)
+	}
+
+	nrgba := image.NewNRGBA(rect)
+	rng.Read(nrgba.Pix)
+
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+	}
+	paletted := image.NewPaletted(rect, palette)
+	rng.Read(paletted.Pix)
+
+	return map[string]image.Image{
+		"Gray":     gray,
+		"YCbCr":    ycbcr,
+		"RGBA":     rgba,
+		"NRGBA":    nrgba,
+		"Paletted": paletted,
+	}
+}
+
+func TestGrayscaleFastPaths(t *testing.T) {
+	// Large enough to be split into bands
+	for name, img := range testImages(400, 300) {
+		gray, alpha := GrayscaleAlpha(img)
+		wantGray, wantAlpha := GrayscaleAlpha(atOnly{img})
+
+		// The Y plane is the luminance computed by the YCbCr encoder, which the formula can be off from by rounding
+		tolerance := 0
+		if name == "YCbCr" {
+			tolerance = 2
+		}
+
+		for i := range gray.Pix {
+			if diff := int(gray.Pix[i]) - int(wantGray.Pix[i]); diff > tolerance || -diff > tolerance {
+				t.Fatalf("%s: gray level of pixel %d is %d, want %d", name, i, gray.Pix[i], wantGray.Pix[i])
+			}
+		}
+		for y := range alpha {
+			for x := range alpha[y] {
+				if alpha[y][x] != wantAlpha[y][x] {
+					t.Fatalf("%s: alpha of pixel %d,%d is %d, want %d", name, x, y, alpha[y][x], wantAlpha[y][x])
+				}
+			}
+		}
+	}
+}
+
+/*
+	Run with go test ./utils -bench Grayscale -cpu 1,4 to see both speedups: Fast against At is the gain of reading
+	the pixel buffers, and the cpu counts show the gain of converting row bands in parallel.
+*/
+func BenchmarkGrayscale(b *testing.B) {
+	for name, img := range testImages(1920, 1080) {
+		b.Run(name+"/Fast", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Grayscale(img)
+			}
+		})
+		b.Run(name+"/At", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Grayscale(atOnly{img})
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Limits bound the images LoadImage reads, so a small file that decodes to a huge image can't run goskii out of
+// memory. 0 is no limit.
+type Limits struct {
+	MaxPixels int64 // Pixels of an image, or of the canvas of an animation
+	MaxBytes  int64 // Bytes read from the file, URL or stdin
+}
+
+// Errors wrapped by the errors of the limits that are hit.
+var (
+	ErrTooManyPixels = errors.New("too many pixels")
+	ErrTooManyBytes  = errors.New("input too large")
+)
+
+// Largest downscale the JPEG decoder of ffmpeg can do while decoding, as a power of two (1/8).
+const maxJPEGLowres = 3
+
+// formatBytes formats a number of bytes in the largest unit that keeps it above 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
+
+// readLimited reads all of r, failing as soon as more than maxBytes are read.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than the limit of %s", ErrTooManyBytes, formatBytes(maxBytes))
+	}
+
+	return data, nil
+}
+
+// pixelsError returns the error of an image over the pixel limit. what leads up to the number of pixels.
+func pixelsError(what string, pixels, maxPixels int64) error {
+	return fmt.Errorf(
+		"%w: %s %.1f megapixels, the limit is %.1f megapixels",
+		ErrTooManyPixels, what, float64(pixels)/1e6, float64(maxPixels)/1e6,
+	)
+}
+
+/*
+	decodeJPEGDownscaled decodes a JPEG too large for the pixel limit at a half, a quarter or an eighth of its
+	size. image/jpeg can only decode the whole image, so ffmpeg does it: with lowres its decoder skips the
+	detail the smaller size doesn't need, and the full image is never in memory. The art is far smaller than
+	the image anyway.
+*/
+func decodeJPEGDownscaled(ctx context.Context, data []byte, config image.Config, maxPixels int64) (image.Image, error) {
+	lowres := 1
+	width, height := config.Width, config.Height
+	for ; lowres <= maxJPEGLowres; lowres++ {
+		// The decoder rounds the size up
+		width, height = (config.Width+1<<lowres-1)>>lowres, (config.Height+1<<lowres-1)>>lowres
+		if int64(width)*int64(height) <= maxPixels {
+			break
+		}
+	}
+	if lowres > maxJPEGLowres {
+		what := fmt.Sprintf("the %dx%d JPEG, at an eighth of its size, still has", config.Width, config.Height)
+		return nil, pixelsError(what, int64(width)*int64(height), maxPixels)
+	}
+
+	var stdout bytes.Buffer
+	source := ffmpeg.Input("pipe:", ffmpeg.KwArgs{"f": "image2pipe", "c:v": "mjpeg", "lowres": strconv.Itoa(lowres)})
+	err := ffmpeg.OutputContext(
+		ctx, []*ffmpeg.Stream{source}, "pipe:1", ffmpeg.KwArgs{
+			"format":   "rawvideo",
+			"pix_fmt":  PixelRGB,
+			"vf":       fmt.Sprintf("scale=%d:%d", width, height),
+			"frames:v": "1",
+		},
+	).WithInput(bytes.NewReader(data)).WithOutput(&stdout).Silent(true).Run()
+	if err != nil {
+		return nil, fmt.Errorf("error downscaling the %dx%d JPEG with ffmpeg: %v", config.Width, config.Height, err)
+	}
+
+	raw := stdout.Bytes()
+	if len(raw) != width*height*3 {
+		return nil, fmt.Errorf("error downscaling the %dx%d JPEG with ffmpeg: short output", config.Width, config.Height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, j := 0, 0; i < len(raw); i, j = i+3, j+4 {
+		img.Pix[j] = raw[i]
+		img.Pix[j+1] = raw[i+1]
+		img.Pix[j+2] = raw[i+2]
+		img.Pix[j+3] = 255
+	}
+
+	return img, nil
+}
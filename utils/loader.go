@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
 	_ "image/gif"
+	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"net/http"
@@ -12,7 +16,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 	_ "golang.org/x/image/bmp"
@@ -20,9 +26,44 @@ import (
 	_ "golang.org/x/image/webp"
 )
 
+// Frame rate used when neither --fps nor the source give one.
+const defaultFrameRate = 12
+
+// Raw pixel formats ExtractFrames decodes video to.
+const (
+	PixelGray = "gray"
+	PixelRGB  = "rgb24"
+	PixelRGBA = "rgba"
+)
+
+// ffmpeg filters that turn frames as each orientation says, indexed by orientation.
+var orientationFilters = [9]string{
+	"", "", "hflip,", "hflip,vflip,", "vflip,", "transpose=cclock_flip,", "transpose=clock,", "transpose=clock_flip,", "transpose=cclock,",
+}
+
+// Pixel formats of ffmpeg with an alpha channel, e.g. yuva420p, yuva444p10le (ProRes 4444), rgba or gbrap.
+var alphaPixelFormat = regexp.MustCompile(`^(yuva|ayuv|gbrap|ya|rgba|bgra|argb|abgr)`)
+
+// StdinPath is the -p path that reads the image or video from stdin.
+const StdinPath = "-"
+
+// Buffered stdin, so the start of the data can be inspected before it is decoded.
+var stdin = bufio.NewReaderSize(os.Stdin, 64*1024)
+
+// PeekStdin returns up to the first n bytes of stdin without consuming them.
+func PeekStdin(n int) ([]byte, error) {
+	header, err := stdin.Peek(n)
+	if err == io.EOF || err == bufio.ErrBufferFull {
+		err = nil
+	}
+
+	return header, err
+}
+
 type ImageData struct {
 	Path      	string
 	Image     	image.Image
+	Animation 	*Animation // Frames of an animated image, nil for a still one. Image is its first frame.
 	Width     	int
 	Height    	int
 	FileName  	string
@@ -31,9 +72,15 @@ type ImageData struct {
 
 type VideoData struct {
 	Path      	string
-	Reader 		*io.PipeReader
+	Reader 		*io.PipeReader // Raw frames, set by ExtractFrames
+	input 		io.Reader // The video data when it is read from stdin
 	Width	  	int
 	Height	  	int
+	Fps 		float64 // Native frame rate
+	Duration 	time.Duration // 0 if unknown
+	HasAudio 	bool
+	HasAlpha 	bool // The video stream has an alpha channel
+	decoder 	string // Decoder that keeps the alpha channel, when the default one drops it
 	FileName  	string
 	Extension 	string
 }
@@ -50,13 +97,36 @@ func extractVideoId(url string) (string, error) {
 	return matches[1], nil
 }
 
-// LoadImage loads an image from the specified path (local or http) and returns an ImageData struct containing the image and metadata.
-func LoadImage(path string) (*ImageData, error) {
+// fileName returns the name of the source file without its extension, which names saved text files.
+func fileName(path string) string {
+	if path == StdinPath {
+		return "stdin"
+	}
+
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+/*
+	LoadImage loads an image from the specified path (local or http) and returns an ImageData struct containing
+	the image and metadata. The frames of animated GIF, APNG and WebP images are found too, and decoded later one
+	at a time. Images are turned upright as their EXIF orientation says. Cancelling ctx aborts a download.
+
+	The input and the decoded image are kept within limits: the size of the image is read from its header before
+	it is decoded, and JPEGs too large for the pixel limit are decoded at a smaller size with ffmpeg.
+*/
+func LoadImage(ctx context.Context, path string, limits Limits) (*ImageData, error) {
 	var reader io.Reader
 
-	if strings.HasPrefix(path, "http") {
+	if path == StdinPath {
+		reader = stdin
+	} else if strings.HasPrefix(path, "http") {
 		// Handle URL input
-		res, err := http.Get(path)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching URL: %v", err)
+		}
+
+		res, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("error fetching URL: %v", err)
 		}
@@ -66,6 +136,14 @@ func LoadImage(path string) (*ImageData, error) {
 			return nil, fmt.Errorf("error fetching URL, status code: %d", res.StatusCode)
 		}
 
+		// Servers that tell the size are turned down before anything is downloaded
+		if limits.MaxBytes > 0 && res.ContentLength > limits.MaxBytes {
+			return nil, fmt.Errorf(
+				"error fetching URL: %w: the image is %s, the limit is %s",
+				ErrTooManyBytes, formatBytes(res.ContentLength), formatBytes(limits.MaxBytes),
+			)
+		}
+
 		reader = res.Body
 	} else {
 		// Handle local file input
@@ -78,33 +156,93 @@ func LoadImage(path string) (*ImageData, error) {
 		reader = file
 	}
 
-	img, _, err := image.Decode(reader)
+	data, err := readLimited(reader, limits.MaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("error decoding image: %v", err)
 	}
 
+	var (
+		img       image.Image
+		animation *Animation
+	)
+
+	// Cameras store the pixels as the sensor reads them and tell how to turn them in the EXIF orientation
+	orientation := exifOrientation(data)
+
+	// An animation is decoded a frame at a time, only its canvas has to stay within the limit
+	pixels := int64(config.Width) * int64(config.Height)
+	switch {
+	case limits.MaxPixels > 0 && pixels > limits.MaxPixels && format == "jpeg":
+		img, err = decodeJPEGDownscaled(ctx, data, config, limits.MaxPixels)
+		if err != nil {
+			return nil, err
+		}
+		img = Orient(img, orientation)
+	case limits.MaxPixels > 0 && pixels > limits.MaxPixels:
+		return nil, pixelsError(fmt.Sprintf("the %dx%d image has", config.Width, config.Height), pixels, limits.MaxPixels)
+	default:
+		animation, err = parseAnimation(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if animation != nil {
+			animation.setOrientation(orientation)
+			if img, err = animation.first(); err != nil {
+				return nil, err
+			}
+		} else {
+			img, _, err = image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("error decoding image: %v", err)
+			}
+			img = Orient(img, orientation)
+		}
+	}
+
 	return &ImageData{
 		Path:      path,
 		Image:     img,
+		Animation: animation,
 		Width:     img.Bounds().Dx(),
 		Height:    img.Bounds().Dy(),
-		FileName:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		FileName:  fileName(path),
 		Extension: filepath.Ext(path),
 	}, nil
 }
 
-// LoadVideo loads a video from the specified path (local, http or youtube) and returns a VideoData struct containing the video stream and metadata.
-func LoadVideo(path string) (*VideoData, error) {
-    var (
-        reader, writer  = io.Pipe()
-        width, height   = 0, 0
-    )
+// parseFrameRate parses a frame rate as reported by ffprobe, e.g. "30000/1001". It returns 0 if the rate is unknown.
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	if !found {
+		den = "1"
+	}
 
-	var metadata struct {
-		Streams []struct {
-			Width  int `json:"width"`
-			Height int `json:"height"`
-		} `json:"streams"`
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
+
+/*
+	LoadVideo loads a video from the specified path (local, http, youtube or - for stdin) and returns a VideoData
+	struct containing its metadata. Fps is the native frame rate of the source, or 12 if it is unknown. Cancelling
+	ctx stops yt-dlp and ffprobe.
+*/
+func LoadVideo(ctx context.Context, path string) (*VideoData, error) {
+	if path == StdinPath {
+		return LoadVideoReader(ctx, stdin)
 	}
 
 	if strings.Contains(path, "youtube.com") || strings.Contains(path, "youtu.be") {
@@ -117,7 +255,8 @@ func LoadVideo(path string) (*VideoData, error) {
 		}
 		outputTemplate := videoId + "-goskii.%(ext)s"
 
-		cmd := exec.Command(
+		cmd := exec.CommandContext(
+			ctx,
 			"yt-dlp",
 			"-f", "bestvideo[height<="+fetchQuality+"][ext=mp4]",
 			"--concurrent-fragments", "4",
@@ -133,42 +272,175 @@ func LoadVideo(path string) (*VideoData, error) {
 			return nil, fmt.Errorf("dowloaded youtube video not found")
 		}
 		path = matches[0]
-    }
+	}
 
 	// Handle HTTP/HTTPS, local file and downloaed youtube video
-	probeResult, err := ffmpeg.Probe(path)
+	probeResult, err := probe(ctx, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error probing video: %v", err)
+	}
+
+	return newVideoData(path, probeResult)
+}
+
+// LoadVideoReader loads a video streamed from a reader. Its Path is StdinPath.
+func LoadVideoReader(ctx context.Context, r io.Reader) (*VideoData, error) {
+	// Keep what ffprobe reads, so ffmpeg can decode the stream from its start
+	var probed bytes.Buffer
+	probeResult, err := probe(ctx, "-", io.TeeReader(r, &probed))
 	if err != nil {
 		return nil, fmt.Errorf("error probing video: %v", err)
 	}
+
+	video, err := newVideoData(StdinPath, probeResult)
+	if err != nil {
+		return nil, err
+	}
+	video.input = io.MultiReader(&probed, r)
+
+	return video, nil
+}
+
+// probe runs ffprobe on path, or on stdin read from r if it is set, and returns its JSON output.
+func probe(ctx context.Context, path string, r io.Reader) (string, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-show_format", "-show_streams", "-of", "json", path)
+	cmd.Stdin = r
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("[%s] %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return stdout.String(), nil
+}
+
+// newVideoData reads the size and frame rate of the first video stream, and whether there is audio, from ffprobe output.
+func newVideoData(path, probeResult string) (*VideoData, error) {
+	var (
+		width, height = 0, 0
+		frameRate     = 0.0
+		hasVideo      = false
+		hasAudio      = false
+		hasAlpha      = false
+		decoder       = ""
+	)
+
+	var metadata struct {
+		Streams []struct {
+			CodecType    string `json:"codec_type"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			CodecName    string `json:"codec_name"`
+			PixFmt       string `json:"pix_fmt"`
+			Tags         struct {
+				AlphaMode string `json:"alpha_mode"`
+			} `json:"tags"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+
 	if err := json.Unmarshal([]byte(probeResult), &metadata); err != nil {
 		return nil, fmt.Errorf("error parsing video metadata: %v", err)
 	}
-	if len(metadata.Streams) == 0 {
+	for _, stream := range metadata.Streams {
+		switch stream.CodecType {
+		case "video":
+			if !hasVideo {
+				width, height = stream.Width, stream.Height
+				frameRate = parseFrameRate(stream.AvgFrameRate)
+				if frameRate == 0 {
+					frameRate = parseFrameRate(stream.RFrameRate)
+				}
+				hasVideo = true
+
+				// WebM keeps the alpha of VP8 and VP9 in a side stream, which only libvpx decodes
+				hasAlpha = alphaPixelFormat.MatchString(stream.PixFmt)
+				if stream.Tags.AlphaMode == "1" {
+					switch stream.CodecName {
+					case "vp8":
+						hasAlpha, decoder = true, "libvpx"
+					case "vp9":
+						hasAlpha, decoder = true, "libvpx-vp9"
+					}
+				}
+			}
+		case "audio":
+			hasAudio = true
+		}
+	}
+	if !hasVideo {
 		return nil, fmt.Errorf("no video streams found")
 	}
-	width, height = metadata.Streams[0].Width, metadata.Streams[0].Height
+	if frameRate == 0 {
+		frameRate = defaultFrameRate
+	}
+
+	// Streams read from stdin may have no duration
+	seconds, _ := strconv.ParseFloat(metadata.Format.Duration, 64)
+
+	return &VideoData{
+		Path:      path,
+		Width:     width,
+		Height:    height,
+		Fps:       frameRate,
+		Duration:  time.Duration(seconds * float64(time.Second)),
+		HasAudio:  hasAudio,
+		HasAlpha:  hasAlpha,
+		decoder:   decoder,
+		FileName:  fileName(path),
+		Extension: filepath.Ext(path),
+	}, nil
+}
+
+/*
+	ExtractFrames starts ffmpeg decoding the video into video.Reader as raw frames at fps frames per second, so
+	the frames always span the duration of the source. ffmpeg scales the frames to width x height, so every frame
+	is exactly width*height bytes of PixelGray, or 3 or 4 times that of PixelRGB or PixelRGBA. The frames are
+	turned as orientation says before they are scaled with filter, width x height is the size once turned.
+	Cancelling ctx kills ffmpeg.
+*/
+func ExtractFrames(ctx context.Context, video *VideoData, width, height int, pixelFormat string, orientation Orientation, filter Filter, fps float64) {
+	reader, writer := io.Pipe()
+	video.Reader = reader
+
+	inputArgs := ffmpeg.KwArgs{}
+	if video.decoder != "" && pixelFormat == PixelRGBA {
+		inputArgs["c:v"] = video.decoder
+	}
+
+	// Frames turned on their side are scaled from their height to the width
+	srcWidth := video.Width
+	if orientation.SwapsAxes() {
+		srcWidth = video.Height
+	}
+	scaleFlags := filter.ffmpegFlags(srcWidth, width)
+
+	source := ffmpeg.Input(video.Path, inputArgs)
+	if video.input != nil {
+		source = ffmpeg.Input("pipe:", inputArgs)
+	}
 
 	go func() {
-		defer writer.Close()
-		err := ffmpeg.Input(path).Output(
-			"pipe:1", ffmpeg.KwArgs{
-				"format": "image2pipe",
-				"vcodec": "mjpeg",
-				"r":      "12",
+		err := ffmpeg.OutputContext(
+			ctx, []*ffmpeg.Stream{source}, "pipe:1", ffmpeg.KwArgs{
+				"format":  "rawvideo",
+				"pix_fmt": pixelFormat,
+				"vf":      orientationFilters[orientation] + fmt.Sprintf("scale=%d:%d:flags=%s", width, height, scaleFlags),
+				"r":       strconv.FormatFloat(fps, 'f', -1, 64),
 			},
-		).WithOutput(writer).Silent(true).Run()
+		).WithInput(video.input).WithOutput(writer).Silent(true).Run()
 
 		if err != nil {
 			writer.CloseWithError(fmt.Errorf("error reading video: %v", err))
+			return
 		}
+		writer.Close()
 	}()
-
-    return &VideoData{
-        Path:      path,
-        Reader:    reader,
-        Width:     width,
-        Height:    height,
-        FileName:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
-        Extension: filepath.Ext(path),
-    }, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+/*
+	Orientation is an EXIF orientation, 1 to 8: how the stored pixels are turned to be shown upright. It is
+	written here as a horizontal flip, if any, followed by a number of quarter turns clockwise:
+
+		1: none                  5: flip, 3 turns (transpose)
+		2: flip                  6: 1 turn
+		3: 2 turns               7: flip, 1 turn (transverse)
+		4: flip, 2 turns         8: 3 turns
+*/
+type Orientation int
+
+const OrientNormal Orientation = 1
+
+// Quarter turns and flip of every orientation, indexed by orientation.
+var orientationSteps = [9]struct {
+	turns int
+	flip  bool
+}{
+	{0, false}, {0, false}, {0, true}, {2, false}, {2, true}, {3, true}, {1, false}, {1, true}, {3, false},
+}
+
+// Flip is a mirroring of the image asked for with --flip.
+type Flip int
+
+const (
+	FlipNone Flip = iota
+	FlipHorizontal
+	FlipVertical
+)
+
+// ParseFlip converts the value of the --flip flag to a Flip.
+func ParseFlip(flip string) (Flip, error) {
+	switch strings.ToLower(flip) {
+	case "", "none":
+		return FlipNone, nil
+	case "horizontal", "h":
+		return FlipHorizontal, nil
+	case "vertical", "v":
+		return FlipVertical, nil
+	default:
+		return FlipNone, fmt.Errorf("unknown flip \"%s\"", flip)
+	}
+}
+
+// orientationOf returns the orientation with the given quarter turns clockwise after an optional flip.
+func orientationOf(turns int, flip bool) Orientation {
+	turns = ((turns % 4) + 4) % 4
+	for o := OrientNormal; o <= 8; o++ {
+		if steps := orientationSteps[o]; steps.turns == turns && steps.flip == flip {
+			return o
+		}
+	}
+
+	return OrientNormal
+}
+
+// RotateFlip returns the orientation of a clockwise rotation by degrees, a multiple of 90, followed by flip.
+func RotateFlip(degrees int, flip Flip) Orientation {
+	turns := degrees / 90
+	switch flip {
+	case FlipHorizontal:
+		// A flip after turning is the same as a flip before turning the other way
+		return orientationOf(-turns, true)
+	case FlipVertical:
+		return orientationOf(2-turns, true)
+	default:
+		return orientationOf(turns, false)
+	}
+}
+
+// Then returns the orientation of o followed by next.
+func (o Orientation) Then(next Orientation) Orientation {
+	if o < 1 || o > 8 {
+		o = OrientNormal
+	}
+	if next < 1 || next > 8 {
+		next = OrientNormal
+	}
+
+	first, second := orientationSteps[o], orientationSteps[next]
+	turns := first.turns
+	if second.flip {
+		turns = -turns
+	}
+
+	return orientationOf(turns+second.turns, first.flip != second.flip)
+}
+
+// SwapsAxes returns whether the orientation turns the image on its side, swapping its width and height.
+func (o Orientation) SwapsAxes() bool {
+	return o >= 5 && o <= 8
+}
+
+/*
+	Orient returns the image turned as the orientation says. The image is copied to RGBA once, then every pixel
+	is moved to its place in the new image.
+*/
+func Orient(img image.Image, o Orientation) image.Image {
+	if o <= OrientNormal || o > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if o.SwapsAxes() {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			si := y*src.Stride + x*4
+			di := dy*dst.Stride + dx*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+/*
+	exifOrientation returns the orientation in the EXIF block of a JPEG, TIFF or WebP image, or OrientNormal
+	if it has none or it can't be read.
+
+	1) JPEG keeps EXIF in an APP1 segment starting with "Exif\0\0", before the image data.
+
+	2) TIFF files are an EXIF block themselves, the orientation is a tag of their first IFD.
+
+	3) WebP keeps it in an EXIF chunk of the extended format.
+*/
+func exifOrientation(data []byte) Orientation {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+			marker := data[i+1]
+			length := int(binary.BigEndian.Uint16(data[i+2:]))
+			if marker == 0xda || length < 2 || i+2+length > len(data) {
+				break // start of scan, the image data comes next
+			}
+
+			segment := data[i+4 : i+2+length]
+			if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return tiffOrientation(segment[6:])
+			}
+			i += 2 + length
+		}
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		return tiffOrientation(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		data = data[12:]
+		for len(data) >= 8 {
+			kind := string(data[:4])
+			length := int(binary.LittleEndian.Uint32(data[4:]))
+			if length > len(data)-8 {
+				break
+			}
+			if kind == "EXIF" {
+				// Some encoders keep the JPEG prefix
+				return tiffOrientation(bytes.TrimPrefix(data[8:8+length], []byte("Exif\x00\x00")))
+			}
+			data = data[8+length+length%2:]
+		}
+	}
+
+	return OrientNormal
+}
+
+// tiffOrientation reads the orientation tag (0x0112) of the first IFD of a TIFF structured EXIF block.
+func tiffOrientation(tiff []byte) Orientation {
+	if len(tiff) < 8 {
+		return OrientNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return OrientNormal
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return OrientNormal
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		// A SHORT value is stored in the first two bytes of the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			o := Orientation(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return OrientNormal
+			}
+			return o
+		}
+	}
+
+	return OrientNormal
+}
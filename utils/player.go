@@ -0,0 +1,483 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ErrQuit is returned when playback is stopped with q.
+var ErrQuit = errors.New("quit")
+
+// Seek step of the left and right arrow keys.
+const seekStep = 5 * time.Second
+
+/*
+	Text of the frames already passed that is kept with controls, so seeking back, stepping back and looping don't
+	convert the frames again. Older frames are dropped, which limits how far back playback can go.
+*/
+const maxKeptBytes = 128 << 20
+
+// Playback speeds + and - step through.
+var playbackSpeeds = []float64{0.25, 0.5, 0.75, 1, 1.25, 1.5, 2, 4}
+
+// Keys understood during playback.
+type playerKey int
+
+const (
+	keyPause playerKey = iota
+	keyBack
+	keyForward
+	keyStepBack
+	keyStepForward
+	keyFaster
+	keySlower
+	keyLoop
+	keyQuit
+	keyInterrupt
+)
+
+/*
+	readKeys puts the terminal in raw mode and sends the playback keys pressed on stdin. Arrow keys arrive as
+	escape sequences, a lone escape quits like q. The returned function restores the terminal. The read can't
+	be interrupted, it is left behind when playback ends.
+*/
+func readKeys() (<-chan playerKey, func(), error) {
+	fd := int(os.Stdin.Fd())
+	prevState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(chan playerKey, 8)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+
+			input := string(buf[:n])
+			for input != "" {
+				var key playerKey
+				var known bool
+				switch {
+				case strings.HasPrefix(input, "\033[C"):
+					key, known, input = keyForward, true, input[3:]
+				case strings.HasPrefix(input, "\033[D"):
+					key, known, input = keyBack, true, input[3:]
+				case strings.HasPrefix(input, "\033["):
+					input = "" // other escape sequences are ignored
+				default:
+					key, known = keyOf(input[0])
+					input = input[1:]
+				}
+
+				if known {
+					select {
+					case keys <- key:
+					default: // drop keys pressed faster than they are handled
+					}
+				}
+			}
+		}
+	}()
+
+	return keys, func() { term.Restore(fd, prevState) }, nil
+}
+
+// keyOf maps a single byte key to a playback key.
+func keyOf(b byte) (playerKey, bool) {
+	switch b {
+	case ' ':
+		return keyPause, true
+	case ',':
+		return keyStepBack, true
+	case '.':
+		return keyStepForward, true
+	case '+', '=':
+		return keyFaster, true
+	case '-', '_':
+		return keySlower, true
+	case 'l', 'L':
+		return keyLoop, true
+	case 'q', 'Q', 27: // q | Q | Escape
+		return keyQuit, true
+	case 3: // Ctrl-C raises no signal in raw mode
+		return keyInterrupt, true
+	}
+
+	return 0, false
+}
+
+// frameSource gives access to frames stored in full, like the ones of a goskii file, in any order.
+type frameSource interface {
+	Len() int
+	Duration(i int) time.Duration
+	Frame(i int) (string, error)
+}
+
+/*
+	player plays a stream of frames against the wall clock. The position in the stream is a time, which moves at
+	speed while playing. The frame shown is the one that covers the position, so frames that are late are skipped.
+
+	Frames are kept as they arrive so playback can seek back, step and loop, until the text of the frames passed
+	grows past keep bytes. The oldest ones are then dropped and playback can't go back further than first. Without
+	controls keep is 0, so the text of a frame is dropped once it has been passed.
+
+	Stored frames are all known in advance, only the text of the frame on screen is read and nothing is kept.
+*/
+type player struct {
+	source <-chan Frame
+	stored frameSource // Frames read when they are drawn, in place of source
+	frames []Frame
+	starts []time.Duration // Position at which every frame starts
+	end    time.Duration   // Position at which the last frame received ends
+	done   bool            // The source is closed, end is the total duration
+	total  time.Duration   // Duration of the stream given by the caller, 0 if unknown
+	keep   int             // Bytes of text of the frames passed that are kept
+	first  int             // Oldest frame whose text is kept
+	kept   int             // Bytes of text of the frames from first on
+
+	at     time.Duration // Position when the clock was last set
+	since  time.Time     // Wall time when the clock was last set
+	speed  int           // Index into playbackSpeeds
+	paused bool
+	loop   bool
+
+	shown    int    // Frame on screen, -1 if none
+	text     string // Text of the stored frame on screen
+	redraw   bool   // The status changed, the frame on screen is drawn again
+	seeking  bool   // Seeking past the frames received, the frames on the way are not drawn
+	rows     int    // Rows of the terminal, for the status line
+	drawn    int    // Frames drawn since fpsSince
+	fpsSince time.Time
+	fps      float64
+}
+
+func newPlayer(source <-chan Frame, total time.Duration) *player {
+	return &player{
+		source: source,
+		total:  total,
+		speed:  3, // 1x
+		shown:  -1,
+	}
+}
+
+// newStoredPlayer returns a player of stored frames, which starts playing right away.
+func newStoredPlayer(stored frameSource) *player {
+	p := newPlayer(nil, 0)
+	p.stored = stored
+	for i := 0; i < stored.Len(); i++ {
+		p.starts = append(p.starts, p.end)
+		p.end += stored.Duration(i)
+	}
+	p.done, p.total = true, p.end
+	p.start(time.Now())
+
+	return p
+}
+
+// start starts the clock at the start of the stream.
+func (p *player) start(now time.Time) {
+	p.at, p.since, p.fpsSince = 0, now, now
+}
+
+// position returns the position at wall time now. The clock only runs once the first frame has arrived.
+func (p *player) position(now time.Time) time.Duration {
+	if p.paused || len(p.starts) == 0 {
+		return p.at
+	}
+
+	return p.at + time.Duration(float64(now.Sub(p.since))*playbackSpeeds[p.speed])
+}
+
+/*
+	seek moves the position to t, clamped to the oldest frame kept, and to the last frame once the stream is
+	complete.
+*/
+func (p *player) seek(t time.Duration, now time.Time) {
+	if len(p.starts) > 0 {
+		if p.done && t >= p.end {
+			t = p.starts[len(p.starts)-1]
+		}
+		t = max(t, p.starts[p.first])
+	}
+
+	p.at, p.since = max(t, 0), now
+	p.seeking = !p.done && p.at >= p.end
+}
+
+/*
+	add appends a frame received from the source. The clock starts with the first frame, so the time ffmpeg
+	takes to start and the first conversion take isn't counted as playing, which would skip the first frames.
+*/
+func (p *player) add(frame Frame) {
+	if len(p.starts) == 0 {
+		p.start(time.Now())
+	}
+
+	p.frames = append(p.frames, frame)
+	p.starts = append(p.starts, p.end)
+	p.end += frame.Duration
+	p.kept += len(frame.ASCII)
+}
+
+// trim drops the text of the oldest frames passed until the ones left fit in keep bytes.
+func (p *player) trim() {
+	for p.first < p.shown && p.kept > p.keep {
+		p.kept -= len(p.frames[p.first].ASCII)
+		p.frames[p.first].ASCII = ""
+		p.first++
+	}
+}
+
+// receive takes a frame from the source, returning false once it is closed.
+func (p *player) receive(frame Frame, ok bool) bool {
+	if !ok {
+		p.done = true
+		return false
+	}
+
+	p.add(frame)
+	return true
+}
+
+// frameAt returns the received frame covering position t, or the last one received if t is past it.
+func (p *player) frameAt(t time.Duration) int {
+	lo, hi := 0, len(p.starts)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if p.starts[mid] <= t {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo
+}
+
+// status returns the status line: play state, elapsed and total time, frames drawn per second, speed and loop.
+func (p *player) status(t time.Duration) string {
+	state := ">"
+	if p.paused {
+		state = "||"
+	}
+
+	total := "--:--"
+	switch {
+	case p.done:
+		total = formatTime(p.end)
+	case p.total > 0:
+		total = formatTime(p.total)
+	}
+
+	line := fmt.Sprintf("%s %s / %s  %.1f fps  %gx", state, formatTime(t), total, p.fps, playbackSpeeds[p.speed])
+	if p.loop {
+		line += "  loop"
+	}
+
+	return line
+}
+
+// formatTime formats a duration as minutes and seconds.
+func formatTime(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+/*
+	draw prints frame i from the top left of the screen and the status line below it, if there is room for it.
+	The terminal may be in raw mode, so lines end with a carriage return too.
+*/
+func (p *player) draw(i int, t time.Duration, now time.Time) error {
+	text, err := p.frameText(i)
+	if err != nil {
+		return err
+	}
+
+	if i != p.shown {
+		p.drawn++
+	}
+	if elapsed := now.Sub(p.fpsSince); elapsed >= time.Second {
+		p.fps = float64(p.drawn) / elapsed.Seconds()
+		p.drawn, p.fpsSince = 0, now
+	}
+
+	p.shown = i
+	p.trim()
+
+	text = strings.Trim(text, "\n")
+	var builder strings.Builder
+	builder.WriteString("\033[H")
+	builder.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	if p.rows == 0 || strings.Count(text, "\n")+2 <= p.rows {
+		builder.WriteString("\033[0m\r\n")
+		builder.WriteString(p.status(t))
+		builder.WriteString("\033[K")
+	}
+	builder.WriteString("\033[J")
+
+	fmt.Print(builder.String())
+	return nil
+}
+
+// frameText returns the text of frame i. A stored frame is only read when it isn't on screen already.
+func (p *player) frameText(i int) (string, error) {
+	if p.stored == nil {
+		return p.frames[i].ASCII, nil
+	}
+
+	if i != p.shown {
+		text, err := p.stored.Frame(i)
+		if err != nil {
+			return "", fmt.Errorf("error reading frame %d: %v", i, err)
+		}
+		p.text = text
+	}
+
+	return p.text, nil
+}
+
+// handle applies a key. It returns the error that ends playback for q and Ctrl-C.
+func (p *player) handle(ctx context.Context, key playerKey, now time.Time) error {
+	t := p.position(now)
+
+	switch key {
+	case keyPause:
+		p.at, p.since = t, now
+		p.paused = !p.paused
+	case keyBack:
+		p.seek(t-seekStep, now)
+	case keyForward:
+		p.seek(t+seekStep, now)
+	case keyStepBack, keyStepForward:
+		// There is nothing to step through before the first frame has arrived
+		if len(p.starts) == 0 {
+			return nil
+		}
+
+		p.paused = true
+		i := p.frameAt(t)
+		if key == keyStepBack {
+			i = max(i-1, p.first)
+		} else if i+1 < len(p.starts) || p.fetch(ctx) {
+			i = min(i+1, len(p.starts)-1)
+		}
+		p.seek(p.starts[i], now)
+	case keyFaster:
+		p.at, p.since = t, now
+		p.speed = min(p.speed+1, len(playbackSpeeds)-1)
+	case keySlower:
+		p.at, p.since = t, now
+		p.speed = max(p.speed-1, 0)
+	case keyLoop:
+		p.loop = !p.loop
+	case keyQuit:
+		return ErrQuit
+	case keyInterrupt:
+		return ErrInterrupted
+	}
+
+	p.redraw = true
+	return nil
+}
+
+// fetch waits for the next frame from the source. It returns false if the source is closed or ctx is cancelled.
+func (p *player) fetch(ctx context.Context) bool {
+	if p.done {
+		return false
+	}
+
+	select {
+	case frame, ok := <-p.source:
+		return p.receive(frame, ok)
+	case <-ctx.Done():
+		return false
+	}
+}
+
+/*
+	run plays until the stream is over, or ctx is cancelled or a key ends it. keys is nil when there are no
+	controls.
+
+	1) The frame covering the current position is drawn if it isn't on screen yet.
+
+	2) The source is only read when the next frame is needed, so a paused player holds the conversion back.
+	Frames that are already waiting are all taken at once, only the last one is drawn.
+
+	3) It then waits for the next frame to be due, the next frame to arrive, a key or ctx.
+*/
+func (p *player) run(ctx context.Context, keys <-chan playerKey) error {
+	for {
+		now := time.Now()
+		t := p.position(now)
+
+		if p.done && t >= p.end {
+			if !p.loop || len(p.starts) == 0 || p.keep == 0 {
+				return nil
+			}
+			// Loop back to the oldest frame kept, the start of the stream unless it is too long to keep
+			p.seek(0, now)
+			t = p.at
+		}
+
+		if p.seeking && (p.done || p.end > t) {
+			p.seeking = false
+		}
+
+		if len(p.starts) > 0 && !p.seeking {
+			if i := p.frameAt(t); i != p.shown || p.redraw {
+				if err := p.draw(i, t, now); err != nil {
+					return err
+				}
+				p.redraw = false
+			}
+		}
+
+		i := p.frameAt(t)
+		var source <-chan Frame
+		if !p.done && i+1 >= len(p.starts) && (!p.paused || p.end <= t) {
+			source = p.source
+		}
+
+		var timer *time.Timer
+		var wake <-chan time.Time
+		if !p.paused && (i+1 < len(p.starts) || p.done) {
+			next := p.end
+			if i+1 < len(p.starts) {
+				next = p.starts[i+1]
+			}
+			timer = time.NewTimer(time.Duration(float64(next-t) / playbackSpeeds[p.speed]))
+			wake = timer.C
+		}
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return nil
+		case key := <-keys:
+			err = p.handle(ctx, key, time.Now())
+		case frame, ok := <-source:
+			// Take the frames already converted while the position is past them
+			for p.receive(frame, ok) && len(p.source) > 0 && p.end <= p.position(time.Now()) {
+				frame, ok = <-p.source
+			}
+		case <-wake:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
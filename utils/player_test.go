@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStepWithoutFrames(t *testing.T) {
+	for _, key := range []playerKey{keyStepBack, keyStepForward} {
+		// ffmpeg is still starting, the first frame is on its way but hasn't been received
+		source := make(chan Frame, 1)
+		source <- Frame{ASCII: "0", Duration: time.Second}
+		p := newPlayer(source, 0)
+		p.keep = maxKeptBytes
+
+		if err := p.handle(context.Background(), key, time.Now()); err != nil {
+			t.Fatalf("key %d: %v", key, err)
+		}
+		if p.paused || p.at != 0 {
+			t.Errorf("key %d moved a player without frames to %v, paused %v", key, p.at, p.paused)
+		}
+	}
+}
+
+func TestStepForwardFetches(t *testing.T) {
+	source := make(chan Frame, 1)
+	p := newPlayer(source, 0)
+	p.keep = maxKeptBytes
+	p.add(Frame{ASCII: "0", Duration: time.Second})
+
+	// The next frame is taken from the source
+	source <- Frame{ASCII: "1", Duration: time.Second}
+	now := time.Now()
+	if err := p.handle(context.Background(), keyStepForward, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.starts) != 2 || p.at != time.Second {
+		t.Errorf("stepped to %v with %d frames, want 1s with 2 frames", p.at, len(p.starts))
+	}
+
+	// The source is over, the player stays on the last frame
+	close(source)
+	if err := p.handle(context.Background(), keyStepForward, now); err != nil {
+		t.Fatal(err)
+	}
+	if !p.done || p.at != time.Second {
+		t.Errorf("stepped past the last frame to %v", p.at)
+	}
+}
+
+func TestClockStartsWithFirstFrame(t *testing.T) {
+	source := make(chan Frame, 1)
+	p := newPlayer(source, 0)
+	p.keep = maxKeptBytes
+
+	// Starting ffmpeg and converting the first frame takes a while
+	if at := p.position(time.Now().Add(time.Minute)); at != 0 {
+		t.Fatalf("position %v before the first frame, want 0", at)
+	}
+
+	p.add(Frame{ASCII: "0", Duration: time.Second})
+	if at := p.position(time.Now()); at > 100*time.Millisecond {
+		t.Errorf("position %v right after the first frame, want about 0", at)
+	}
+}
+
+func TestTrimKeepsWindow(t *testing.T) {
+	p := newPlayer(make(chan Frame), 0)
+	p.keep = 2
+	for _, text := range []string{"a", "b", "c", "d"} {
+		p.add(Frame{ASCII: text, Duration: time.Second})
+	}
+
+	// The frame on screen and the ones after it are kept whatever their size
+	p.shown = 3
+	p.trim()
+	if p.first != 2 || p.kept != 2 || p.frames[1].ASCII != "" || p.frames[2].ASCII != "c" {
+		t.Fatalf("kept frames from %d, %d bytes, want from 2, 2 bytes", p.first, p.kept)
+	}
+
+	// Seeking and stepping back stop at the oldest frame kept
+	now := time.Now()
+	p.paused = true
+	p.seek(0, now)
+	if p.at != 2*time.Second {
+		t.Errorf("seeked back to %v, want 2s", p.at)
+	}
+	if err := p.handle(context.Background(), keyStepBack, now); err != nil {
+		t.Fatal(err)
+	}
+	if p.at != 2*time.Second {
+		t.Errorf("stepped back to %v, want 2s", p.at)
+	}
+}
+
+// storedFrames is a frameSource counting the frames read.
+type storedFrames struct {
+	texts []string
+	reads int
+}
+
+func (s *storedFrames) Len() int {
+	return len(s.texts)
+}
+
+func (s *storedFrames) Duration(i int) time.Duration {
+	return time.Second
+}
+
+func (s *storedFrames) Frame(i int) (string, error) {
+	s.reads++
+	return s.texts[i], nil
+}
+
+func TestStoredReadsShownFrame(t *testing.T) {
+	stored := &storedFrames{texts: []string{"a", "b", "c"}}
+	p := newStoredPlayer(stored)
+	if !p.done || p.end != 3*time.Second || len(p.starts) != 3 {
+		t.Fatalf("stored player with %d frames ending at %v, want 3 frames ending at 3s", len(p.starts), p.end)
+	}
+
+	// Redrawing the frame on screen doesn't read it again
+	for i := 0; i < 2; i++ {
+		text, err := p.frameText(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != "c" {
+			t.Errorf("frame 2 is %q, want \"c\"", text)
+		}
+		p.shown = 2
+	}
+	if stored.reads != 1 {
+		t.Errorf("read %d frames, want 1", stored.reads)
+	}
+}
@@ -1,95 +1,290 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/term"
 )
 
-func waitKeyPress() {
+var ansiEscape = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Frame is one frame of ASCII art and how long it stays on screen. A stream of frames that fails ends with a
+// frame holding only the error.
+type Frame struct {
+	ASCII    string
+	Duration time.Duration
+	Err      error
+}
+
+// ErrInterrupted is returned when Ctrl-C is pressed while the terminal is in raw mode, where it raises no signal.
+var ErrInterrupted = errors.New("interrupted")
+
+/*
+	waitKeyPress waits for Enter, which returns true, or for Escape or q, which return false. The terminal is put
+	in raw mode while waiting and always restored, also when ctx is cancelled or Ctrl-C is pressed.
+*/
+func waitKeyPress(ctx context.Context) (bool, error) {
 	prevState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return false, err
 	}
 	defer term.Restore(int(os.Stdin.Fd()), prevState)
 
-	buf := make([]byte, 1)
-	loop:
-		for {
-			_, err := os.Stdin.Read(buf)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error: %v\n", err)
-				os.Exit(1)
+	// A read can't be interrupted, so a key is only read once the previous one was ignored. That way no read is
+	// left behind to take the first key pressed after the prompt, unless ctx is cancelled while waiting.
+	keys := make(chan byte, 1)
+	errc := make(chan error, 1)
+	readKey := func() {
+		go func() {
+			buf := make([]byte, 1)
+			if _, err := os.Stdin.Read(buf); err != nil {
+				errc <- err
+				return
 			}
-	
-			switch buf[0] {
-			case 13: break loop // Enter
-			case 27, 81, 113: os.Exit(0) // Escape | Q | q
+			keys <- buf[0]
+		}()
+	}
+
+	for readKey(); ; readKey() {
+		select {
+		case <-ctx.Done():
+			return false, context.Cause(ctx)
+		case err := <-errc:
+			return false, err
+		case key := <-keys:
+			switch key {
+			case 13: // Enter
+				return true, nil
+			case 27, 81, 113: // Escape | Q | q
+				return false, nil
+			case 3: // Ctrl-C
+				return false, ErrInterrupted
 			}
 		}
+	}
 }
 
-func Render(path string, fps int) {
-	file, err := os.Open(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
-	defer file.Close()
+// VisibleWidth returns the number of characters a line occupies in the terminal, ignoring ANSI color escapes.
+func VisibleWidth(line string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(line, ""))
+}
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+/*
+	fitsWidth checks that art lineWidth characters wide fits in the terminal. If it doesn't, it asks to resize the
+	terminal and waits for Enter, or for q, which returns false.
+*/
+func fitsWidth(ctx context.Context, lineWidth int) (bool, error) {
+	// Pipes and files have no width to fit in
+	if !IsTerminal() {
+		return true, nil
 	}
 
-	firstLine := strings.SplitN(string(content), "\n", 2)[0]
-	lineWidth := len(firstLine)
-
 	termW, _, err := GetTerminalSize()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return false, err
 	}
 
 	if lineWidth > termW {
 		widthDiff := lineWidth - termW
 		fmt.Printf("The ASCII is %d characters wider than the terminal. Resize the terminal to fit the ASCII art.\n", widthDiff)
 		fmt.Println("Press 'Enter' to continue...")
-		waitKeyPress()
+		return waitKeyPress(ctx)
+	}
+
+	return true, nil
+}
+
+/*
+	Render shows an ASCII art file, playing it as a video if it has more than one frame. goskii files keep the
+	duration of every frame, which fps overrides if it is set. Legacy text files have their frames separated by
+	blank lines and play at fps, or 12 frames per second.
+*/
+func Render(ctx context.Context, path string, fps int) error {
+	if IsArtFile(path) {
+		return renderArtFile(ctx, path, fps)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	firstLine := strings.SplitN(string(content), "\n", 2)[0]
+	if ok, err := fitsWidth(ctx, VisibleWidth(firstLine)); !ok {
+		return err
 	}
 
 	checkVideo := strings.Split(string(content), "\n\n")
 	if len(checkVideo) > 1 {
-		RenderVideo(string(content), fps)
+		return RenderVideo(ctx, string(content), fps)
 	} else {
 		fmt.Print(string(content))
 	}
+
+	return nil
 }
 
-func RenderVideo(ascii string, fps int) {
-	frames := strings.Split(ascii, "\n\n")
+/*
+	artFrames reads the frames of a goskii file for the player. Their durations are replaced by fps if it is set,
+	and their colors are stripped if stripColors is set.
+*/
+type artFrames struct {
+	art         *ArtFile
+	fps         int
+	stripColors bool
+}
 
-	var finalFps time.Duration
-	if fps == 0 {
-		finalFps = time.Duration(12)
-	} else {
-		finalFps = time.Duration(fps)
+func (a artFrames) Len() int {
+	return a.art.Len()
+}
+
+func (a artFrames) Duration(i int) time.Duration {
+	if a.fps > 0 {
+		return time.Second / time.Duration(a.fps)
 	}
-	frameDelay := time.Second / finalFps
+	return a.art.Duration(i)
+}
 
-	ClearTerminal()
+func (a artFrames) Frame(i int) (string, error) {
+	text, err := a.art.Frame(i)
+	if err != nil {
+		return "", err
+	}
+	if a.stripColors {
+		text = ansiEscape.ReplaceAllString(text, "")
+	}
+	return text, nil
+}
+
+/*
+	renderArtFile plays a goskii file. The player reads the frames from the file when it draws them, so seeking
+	anywhere in the file is immediate and only the frame on screen is in memory. Colors are stripped if NO_COLOR
+	is set.
+*/
+func renderArtFile(ctx context.Context, path string, fps int) error {
+	art, err := OpenArtFile(path)
+	if err != nil {
+		return err
+	}
+	defer art.Close()
+
+	if ok, err := fitsWidth(ctx, art.Header.Width); !ok {
+		return err
+	}
+
+	frames := artFrames{
+		art:         art,
+		fps:         fps,
+		stripColors: art.Header.Color != "none" && os.Getenv("NO_COLOR") != "",
+	}
+
+	if art.Len() == 1 {
+		text, err := frames.Frame(0)
+		if err != nil {
+			return fmt.Errorf("error reading frame 0: %v", err)
+		}
+		fmt.Println(text)
+		return nil
+	}
+
+	if !IsTerminal() {
+		return writeStoredFrames(os.Stdout, frames)
+	}
+
+	return playInTerminal(ctx, newStoredPlayer(frames))
+}
+
+// RenderVideo plays the frames of an ASCII art file, separated by blank lines, at fps frames per second.
+func RenderVideo(ctx context.Context, ascii string, fps int) error {
+	if fps <= 0 {
+		fps = defaultFrameRate
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	texts := strings.Split(ascii, "\n\n")
+	duration := time.Second / time.Duration(fps)
+
+	frames := make(chan Frame)
+	go func() {
+		defer close(frames)
+		for _, frame := range texts {
+			select {
+			case frames <- Frame{ASCII: frame, Duration: duration}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return PlayVideo(ctx, frames, time.Duration(len(texts))*duration)
+}
+
+/*
+	PlayVideo plays frames in the terminal as they arrive on the channel, each for its own duration, with a
+	status line below them. total is the duration of the stream if it is known in advance, or 0. Frames that
+	are late are skipped, so playback keeps the duration of the source when the conversion or the terminal
+	can't keep up. When stdout is not a terminal, the frames are written one after another as plain text instead,
+	as fast as they arrive.
+
+	When stdin is a terminal, playback is controlled with the keyboard: space pauses, the left and right arrows
+	seek 5 seconds, , and . step one frame, + and - change the speed, l loops and q quits with ErrQuit. Ctrl-C
+	returns ErrInterrupted.
 
-	for _, frame := range frames {
-		fmt.Print("\033[H")
-		fmt.Print(frame)
-		time.Sleep(frameDelay)
+	PlayVideo returns once the frames are over, when ctx is cancelled or when a key stops it. The channel is only
+	drained in the first case, the producer has to be stopped otherwise. The colors, the cursor and the screen
+	are restored before it returns.
+*/
+func PlayVideo(ctx context.Context, frames <-chan Frame, total time.Duration) error {
+	if !IsTerminal() {
+		return writeFrames(os.Stdout, frames)
+	}
+
+	return playInTerminal(ctx, newPlayer(frames, total))
+}
+
+/*
+	playInTerminal runs p on a cleared screen with the cursor hidden. When stdin is a terminal, it is put in raw
+	mode to read the playback keys and the frames passed are kept for going back.
+*/
+func playInTerminal(ctx context.Context, p *player) error {
+	var keys <-chan playerKey
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		var restore func()
+		var err error
+		keys, restore, err = readKeys()
+		if err != nil {
+			return err
+		}
+		defer restore()
+		p.keep = maxKeptBytes
 	}
 
 	ClearTerminal()
-}
\ No newline at end of file
+	fmt.Print("\033[?25l")
+	defer func() {
+		fmt.Print("\033[0m\033[?25h")
+		ClearTerminal()
+	}()
+
+	if _, rows, err := GetTerminalSize(); err == nil {
+		p.rows = rows
+	}
+
+	return p.run(ctx, keys)
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"fmt"
 	"image"
-	"image/color"
+	"image/draw"
 	"math"
+	"strings"
 )
 
 // Helper function to get the minimum of two integers
@@ -14,81 +16,310 @@ func min(a, b int) int {
 	return b
 }
 
-// Bilinear interpolation function
-func bilinearInterpolate(x, y float64, x1, y1, x2, y2 float64, q11, q12, q21, q22 uint8) uint8 {
-	r1 := ((x2 - x) / (x2 - x1)) * float64(q11) + ((x - x1) / (x2 - x1)) * float64(q21)
-	r2 := ((x2 - x) / (x2 - x1)) * float64(q12) + ((x - x1) / (x2 - x1)) * float64(q22)
-	result := ((y2 - y) / (y2 - y1)) * r1 + ((y - y1) / (y2 - y1)) * r2
+// Filter is the resampling filter images are resized with.
+type Filter int
 
-	return uint8(math.Round(result))
+const (
+	FilterAuto     Filter = iota // Box when shrinking, bilinear when enlarging
+	FilterBox                    // Average of the source pixels under each pixel
+	FilterBilinear               // Linear interpolation between the nearest pixels
+	FilterLanczos3               // Windowed sinc over 3 lobes, the sharpest
+	FilterMitchell               // Mitchell-Netravali cubic (B = C = 1/3), smooth without ringing
+	FilterNearest                // Nearest source pixel, no smoothing at all
+)
+
+// ParseFilter converts the value of the --filter flag to a Filter.
+func ParseFilter(filter string) (Filter, error) {
+	switch strings.ToLower(filter) {
+	case "", "auto":
+		return FilterAuto, nil
+	case "box", "area":
+		return FilterBox, nil
+	case "bilinear", "linear":
+		return FilterBilinear, nil
+	case "lanczos", "lanczos3":
+		return FilterLanczos3, nil
+	case "mitchell":
+		return FilterMitchell, nil
+	case "nearest":
+		return FilterNearest, nil
+	default:
+		return FilterAuto, fmt.Errorf("unknown filter \"%s\"", filter)
+	}
+}
+
+// String returns the name of the filter, as accepted by ParseFilter.
+func (f Filter) String() string {
+	switch f {
+	case FilterBox:
+		return "box"
+	case FilterBilinear:
+		return "bilinear"
+	case FilterLanczos3:
+		return "lanczos3"
+	case FilterMitchell:
+		return "mitchell"
+	case FilterNearest:
+		return "nearest"
+	default:
+		return "auto"
+	}
+}
+
+// resolve returns the filter used to resize from srcSize to dstSize pixels, which only differs for FilterAuto.
+func (f Filter) resolve(srcSize, dstSize int) Filter {
+	if f != FilterAuto {
+		return f
+	}
+	if dstSize < srcSize {
+		return FilterBox
+	}
+
+	return FilterBilinear
+}
+
+// kernel returns the weight function of the filter and how far from its center it reaches, in pixels.
+func (f Filter) kernel() (func(t float64) float64, float64) {
+	switch f {
+	case FilterBilinear:
+		return func(t float64) float64 {
+			return math.Max(0, 1-math.Abs(t))
+		}, 1
+	case FilterLanczos3:
+		return func(t float64) float64 {
+			if t == 0 {
+				return 1
+			}
+			if t <= -3 || t >= 3 {
+				return 0
+			}
+			pt := math.Pi * t
+			return 3 * math.Sin(pt) * math.Sin(pt/3) / (pt * pt)
+		}, 3
+	case FilterMitchell:
+		const b, c = 1.0 / 3, 1.0 / 3
+		return func(t float64) float64 {
+			t = math.Abs(t)
+			switch {
+			case t < 1:
+				return ((12-9*b-6*c)*t*t*t + (-18+12*b+6*c)*t*t + (6 - 2*b)) / 6
+			case t < 2:
+				return ((-b-6*c)*t*t*t + (6*b+30*c)*t*t + (-12*b-48*c)*t + (8*b + 24*c)) / 6
+			default:
+				return 0
+			}
+		}, 2
+	default: // FilterBox
+		return func(t float64) float64 {
+			if t >= -0.5 && t < 0.5 {
+				return 1
+			}
+			return 0
+		}, 0.5
+	}
 }
 
-// ResizeGray resizes a grayscale image using bilinear interpolation
-func ResizeGray(img *image.Gray, newWidth, newHeight int) *image.Gray {
+// ffmpegFlags returns the flags of the ffmpeg scale filter that resize like the filter from srcSize to dstSize.
+func (f Filter) ffmpegFlags(srcSize, dstSize int) string {
+	switch f.resolve(srcSize, dstSize) {
+	case FilterBilinear:
+		return "bilinear"
+	case FilterLanczos3:
+		return "lanczos:param0=3"
+	case FilterMitchell:
+		return "bicubic:param0=0.3333:param1=0.3333"
+	case FilterNearest:
+		return "neighbor"
+	default:
+		return "area"
+	}
+}
+
+// The source pixels one destination pixel is made of, and their weights.
+type contribution struct {
+	start   int
+	weights []float32
+}
+
+/*
+	contributions returns which source pixels make up every destination pixel along one axis, and how much.
+
+	1) The center of every destination pixel is mapped back onto the source.
+
+	2) When shrinking, the kernel is stretched by the ratio, so it covers every source pixel under the
+	destination pixel instead of skipping most of them.
+
+	3) The weights are normalized, and the source pixels past the edges are folded onto the edge pixels.
+*/
+func contributions(srcSize, dstSize int, f Filter) []contribution {
+	f = f.resolve(srcSize, dstSize)
+	ratio := float64(srcSize) / float64(dstSize)
+	contribs := make([]contribution, dstSize)
+
+	if f == FilterNearest {
+		for i := range contribs {
+			src := min(int((float64(i)+0.5)*ratio), srcSize-1)
+			contribs[i] = contribution{start: src, weights: []float32{1}}
+		}
+		return contribs
+	}
+
+	weight, support := f.kernel()
+	scale := math.Max(ratio, 1)
+	support *= scale
+
+	for i := range contribs {
+		center := (float64(i) + 0.5) * ratio
+		left := int(math.Floor(center - support))
+		right := int(math.Ceil(center + support))
+
+		start := max(left, 0)
+		end := min(right, srcSize-1)
+		weights := make([]float32, end-start+1)
+
+		var sum float64
+		for j := left; j <= right; j++ {
+			w := weight((float64(j) + 0.5 - center) / scale)
+			if w == 0 {
+				continue
+			}
+			k := min(max(j, start), end) - start
+			weights[k] += float32(w)
+			sum += w
+		}
+
+		// A box narrower than a pixel can fall between two pixel centers, the nearest one is used then
+		if sum == 0 {
+			k := min(max(int(center), start), end) - start
+			weights[k], sum = 1, 1
+		}
+		for k := range weights {
+			weights[k] /= float32(sum)
+		}
+
+		contribs[i] = contribution{start: start, weights: weights}
+	}
+
+	return contribs
+}
+
+func min8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// clampByte rounds a filtered value to a byte. Lanczos and Mitchell can overshoot both ends.
+func clampByte(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+/*
+	resample resizes interleaved 8 bit pixels of channels channels, first along rows into a float buffer, then
+	along columns into the destination. Separating the passes makes the cost grow with the size of the kernel,
+	not with its area.
+*/
+func resample(src []uint8, srcStride, srcWidth, srcHeight int, dst []uint8, dstStride, dstWidth, dstHeight, channels int, f Filter) {
+	cols := contributions(srcWidth, dstWidth, f)
+	rows := contributions(srcHeight, dstHeight, f)
+
+	rowLen := dstWidth * channels
+	tmp := make([]float32, srcHeight*rowLen)
+	for y := 0; y < srcHeight; y++ {
+		srcRow := src[y*srcStride:]
+		tmpRow := tmp[y*rowLen : (y+1)*rowLen]
+		for x, contrib := range cols {
+			for c := 0; c < channels; c++ {
+				var v float32
+				for k, w := range contrib.weights {
+					v += w * float32(srcRow[(contrib.start+k)*channels+c])
+				}
+				tmpRow[x*channels+c] = v
+			}
+		}
+	}
+
+	for y, contrib := range rows {
+		dstRow := dst[y*dstStride:]
+		for i := 0; i < rowLen; i++ {
+			var v float32
+			for k, w := range contrib.weights {
+				v += w * tmp[(contrib.start+k)*rowLen+i]
+			}
+			dstRow[i] = clampByte(v)
+		}
+	}
+}
+
+// ResizeGray resizes a grayscale image with the filter.
+func ResizeGray(img *image.Gray, newWidth, newHeight int, filter Filter) *image.Gray {
 	origWidth := img.Bounds().Dx()
 	origHeight := img.Bounds().Dy()
 
-	resizedImage := image.NewGray(image.Rect(0, 0, newWidth, newHeight))
-	xRatio := float64(origWidth) / float64(newWidth)
-	yRatio := float64(origHeight) / float64(newHeight)
-
-	for y := 0; y < newHeight; y++ {
-		for x := 0; x < newWidth; x++ {
-			origX := float64(x) * xRatio
-			origY := float64(y) * yRatio
-
-			// Find the four surrounding pixels
-			x1 := int(origX)
-			y1 := int(origY)
-			x2 := min(x1+1, origWidth-1)
-			y2 := min(y1+1, origHeight-1)
-
-			// Get pixel values
-			q11 := img.GrayAt(x1, y1).Y
-			q21 := img.GrayAt(x2, y1).Y
-			q12 := img.GrayAt(x1, y2).Y
-			q22 := img.GrayAt(x2, y2).Y
-
-			// Perform bilinear interpolation
-			lum := bilinearInterpolate(origX, origY, float64(x1), float64(y1), float64(x2), float64(y2), q11, q12, q21, q22)
-			resizedImage.SetGray(x, y, color.Gray{Y: lum})
-		}
+	// Frames decoded by ffmpeg already have the target size
+	if origWidth == newWidth && origHeight == newHeight && img.Rect.Min == (image.Point{}) {
+		return img
 	}
 
+	resizedImage := image.NewGray(image.Rect(0, 0, newWidth, newHeight))
+	src := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y):]
+	resample(src, img.Stride, origWidth, origHeight, resizedImage.Pix, resizedImage.Stride, newWidth, newHeight, 1, filter)
+
 	return resizedImage
 }
 
-// ResizeAlpha resizes a 2D alpha channel array using bilinear interpolation
-func ResizeAlpha(alpha [][]uint8, origWidth, origHeight, newWidth, newHeight int) [][]uint8 {
+// ResizeAlpha resizes a 2D alpha channel array with the filter.
+func ResizeAlpha(alpha [][]uint8, origWidth, origHeight, newWidth, newHeight int, filter Filter) [][]uint8 {
+	src := make([]uint8, origWidth*origHeight)
+	for y := 0; y < origHeight; y++ {
+		copy(src[y*origWidth:], alpha[y][:origWidth])
+	}
+
+	dst := make([]uint8, newWidth*newHeight)
+	resample(src, origWidth, origWidth, origHeight, dst, newWidth, newWidth, newHeight, 1, filter)
+
 	resizedAlpha := make([][]uint8, newHeight)
 	for i := range resizedAlpha {
-		resizedAlpha[i] = make([]uint8, newWidth)
+		resizedAlpha[i] = dst[i*newWidth : (i+1)*newWidth]
 	}
 
-	xRatio := float64(origWidth) / float64(newWidth)
-	yRatio := float64(origHeight) / float64(newHeight)
+	return resizedAlpha
+}
 
-	for y := 0; y < newHeight; y++ {
-		for x := 0; x < newWidth; x++ {
-			origX := float64(x) * xRatio
-			origY := float64(y) * yRatio
+// ResizeRGBA resizes a color image with the filter, on each channel. The channels are premultiplied by alpha,
+// so transparent pixels don't bleed their color into the pixels around them.
+func ResizeRGBA(img image.Image, newWidth, newHeight int, filter Filter) *image.RGBA {
+	bounds := img.Bounds()
+	origWidth := bounds.Dx()
+	origHeight := bounds.Dy()
 
-			// Find the four surrounding pixels
-			x1 := int(origX)
-			y1 := int(origY)
-			x2 := min(x1+1, origWidth-1)
-			y2 := min(y1+1, origHeight-1)
+	src, ok := img.(*image.RGBA)
+	if ok && origWidth == newWidth && origHeight == newHeight && bounds.Min == (image.Point{}) {
+		return src
+	}
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, origWidth, origHeight))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
 
-			// Get intensity values
-			q11 := alpha[y1][x1]
-			q21 := alpha[y1][x2]
-			q12 := alpha[y2][x1]
-			q22 := alpha[y2][x2]
+	resizedImage := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	pix := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):]
+	resample(pix, src.Stride, origWidth, origHeight, resizedImage.Pix, resizedImage.Stride, newWidth, newHeight, 4, filter)
 
-			// Perform bilinear interpolation
-			resizedAlpha[y][x] = bilinearInterpolate(origX, origY, float64(x1), float64(y1), float64(x2), float64(y2), q11, q12, q21, q22)
-		}
+	// Overshoot can leave a channel above alpha, which premultiplied colors never are
+	out := resizedImage.Pix
+	for i := 0; i < len(out); i += 4 {
+		a := out[i+3]
+		out[i], out[i+1], out[i+2] = min8(out[i], a), min8(out[i+1], a), min8(out[i+2], a)
 	}
 
-	return resizedAlpha
+	return resizedImage
 }
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"os"
 )
 
@@ -18,4 +22,49 @@ func SaveToTextFile(ascii string, path string, fileName string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// writeFrames writes video frames to w as they arrive, each followed by a blank line.
+func writeFrames(w io.Writer, frames <-chan Frame) error {
+	writer := bufio.NewWriter(w)
+	for frame := range frames {
+		writer.WriteString(frame.ASCII)
+		if _, err := writer.WriteString("\n\n"); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// writeStoredFrames writes stored frames to w one after another, each followed by a blank line.
+func writeStoredFrames(w io.Writer, frames frameSource) error {
+	writer := bufio.NewWriter(w)
+	for i := 0; i < frames.Len(); i++ {
+		text, err := frames.Frame(i)
+		if err != nil {
+			return fmt.Errorf("error reading frame %d: %v", i, err)
+		}
+		writer.WriteString(text)
+		if _, err := writer.WriteString("\n\n"); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// SaveToPNG encodes an image as PNG at the given file path.
+func SaveToPNG(img image.Image, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	return nil
+}
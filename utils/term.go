@@ -9,6 +9,11 @@ import (
 	"golang.org/x/term"
 )
 
+// IsTerminal returns whether stdout is a terminal. When it isn't, the art is written as plain text.
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
 // Returns the width and height of the terminal.
 func GetTerminalSize() (int, int, error) {
 	if !term.IsTerminal(int(os.Stdout.Fd())) {
@@ -24,36 +29,28 @@ func GetTerminalSize() (int, int, error) {
 }
 
 
-// Calculates the new width and height of the image based on the terminal size or the size flag.
-func CalculateNewBounds(width, height, size int) (int, int, error) {
+// FitTerminal returns the size in characters of the largest art of a width x height image that fits in the terminal.
+func FitTerminal(width, height int) (int, int, error) {
 	terminalWidth, terminalHeight, err := GetTerminalSize()
 	if err != nil {
 		return 0, 0, err
 	}
 
 	heightScale := 2.0 // default scale to compensate character height of the terminal
-	var newWidth, newHeight int
-	if (size == 0) {
-		terminalRatio := float64(terminalWidth) / float64(terminalHeight)
-		imageRatio := float64(width) / float64(height)
-		
-		var scalingFactor float64
-		if terminalRatio > imageRatio {
-			scalingFactor = float64(terminalHeight) / float64(height) 
-		} else {
-			scalingFactor = float64(terminalWidth) / float64(width)
-		}
-		
-		newWidth := int(float64(width) * scalingFactor * heightScale)
-		newHeight := int(float64(height) * scalingFactor) - 1
+	terminalRatio := float64(terminalWidth) / float64(terminalHeight)
+	imageRatio := float64(width) / float64(height)
 
-		return newWidth, newHeight, nil
+	var scalingFactor float64
+	if terminalRatio > imageRatio {
+		scalingFactor = float64(terminalHeight) / float64(height)
 	} else {
-		newWidth = size
-		newHeight = int(float64(height) * float64(newWidth) / (float64(width) * heightScale))
-
-		return newWidth, newHeight, nil
+		scalingFactor = float64(terminalWidth) / float64(width)
 	}
+
+	newWidth := int(float64(width) * scalingFactor * heightScale)
+	newHeight := int(float64(height) * scalingFactor) - 1
+
+	return newWidth, newHeight, nil
 }
 
 // Clears the terminal screen based on the OS.